@@ -0,0 +1,123 @@
+// Package analysis implements control flow analyses of graphs.
+package analysis
+
+import (
+	"sort"
+
+	"decomp.org/x/graphs/dom"
+	"github.com/mewfork/dot"
+	"github.com/mewkiz/pkg/errutil"
+)
+
+// Entry returns the entry node of graph. The entry node is identified using the
+// node "label" attribute, e.g.
+//
+//    0 [label="entry"]
+//
+// If no node has the "entry" label, the entry node is the unique node without
+// predecessors.
+func Entry(graph *dot.Graph) (*dot.Node, error) {
+	var entry *dot.Node
+	for _, node := range graph.Nodes.Nodes {
+		if node.Attrs["label"] != "entry" {
+			continue
+		}
+		if entry != nil {
+			return nil, errutil.Newf(`redefinition of node with "entry" label; previous node %q, new node %q`, entry.Name, node.Name)
+		}
+		entry = node
+	}
+	if entry != nil {
+		return entry, nil
+	}
+	for _, node := range graph.Nodes.Nodes {
+		if len(node.Preds) != 0 {
+			continue
+		}
+		if entry != nil {
+			return nil, errutil.Newf("unable to locate entry node; nodes %q and %q both lack predecessors", entry.Name, node.Name)
+		}
+		entry = node
+	}
+	if entry == nil {
+		return nil, errutil.New("unable to locate entry node")
+	}
+	return entry, nil
+}
+
+// flowGraph is a mutable copy of the nodes of a graph reachable from its entry
+// node, represented by sets of node names.
+type flowGraph struct {
+	entry string
+	// sorted node names.
+	names []string
+	preds map[string]map[string]bool
+	succs map[string]map[string]bool
+}
+
+// newFlowGraph returns a mutable copy of the nodes of graph reachable from the
+// entry node.
+func newFlowGraph(graph *dot.Graph, entry *dot.Node) *flowGraph {
+	g := &flowGraph{
+		entry: entry.Name,
+		preds: make(map[string]map[string]bool),
+		succs: make(map[string]map[string]bool),
+	}
+	g.visit(entry)
+	for name := range g.succs {
+		g.names = append(g.names, name)
+	}
+	sort.Strings(g.names)
+	for _, name := range g.names {
+		for _, pred := range graph.Nodes.Lookup[name].Preds {
+			if _, ok := g.succs[pred.Name]; ok {
+				g.preds[name][pred.Name] = true
+			}
+		}
+	}
+	return g
+}
+
+// visit adds node and its successors to g, recursively.
+func (g *flowGraph) visit(node *dot.Node) {
+	if _, ok := g.succs[node.Name]; ok {
+		return
+	}
+	g.succs[node.Name] = make(map[string]bool)
+	g.preds[node.Name] = make(map[string]bool)
+	for _, succ := range node.Succs {
+		g.succs[node.Name][succ.Name] = true
+		g.visit(succ)
+	}
+}
+
+// domTree returns the dominator tree of g, rooted at its entry node. Nodes
+// unreachable from the entry node are not part of g, and are therefore not
+// treated as additional roots of the tree.
+func (g *flowGraph) domTree() *dom.Tree {
+	graph := dot.NewGraph()
+	graph.SetName("flow")
+	for _, name := range g.names {
+		var attrs map[string]string
+		if name == g.entry {
+			attrs = map[string]string{"label": "entry"}
+		}
+		graph.AddNode("flow", name, attrs)
+	}
+	for _, name := range g.names {
+		for _, succ := range sorted(g.succs[name]) {
+			graph.AddEdge(name, "", succ, "", true, nil)
+		}
+	}
+	return dom.New(graph)
+}
+
+// sorted returns the sorted keys of set.
+func sorted(set map[string]bool) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,321 @@
+package analysis
+
+// cycleGraph is a control flow graph augmented with virtual start and end
+// nodes, and an edge from the end node to the start node, which makes the graph
+// strongly connected. Only the nodes which are reachable from the entry node
+// and which reach a node without successors are kept.
+//
+// Node IDs are assigned in sorted node name order, followed by the start and
+// end node.
+type cycleGraph struct {
+	// Number of nodes, excluding the virtual nodes.
+	n int
+	// mapping from node ID to node name; the virtual nodes have empty names.
+	names []string
+	// set of node names kept.
+	kept map[string]bool
+	// Node IDs of the virtual start and end nodes.
+	start, end int
+	// Edges of the graph; the edge from the end node to the start node is last.
+	edges []cycleEdge
+	// Edge IDs of the outgoing edges of each node, excluding the edge from the
+	// end node to the start node.
+	out [][]int
+	// Edge IDs of the incident edges of each node, excluding self-loops.
+	inc [][]int
+}
+
+// cycleEdge represents a directed edge of a cycle graph.
+type cycleEdge struct {
+	src, dst int
+}
+
+// newCycleGraph returns the cycle graph of g.
+func newCycleGraph(g *flowGraph) *cycleGraph {
+	// Locate the nodes which reach a node without successors.
+	kept := make(map[string]bool)
+	var work []string
+	for _, name := range g.names {
+		if len(g.succs[name]) == 0 {
+			kept[name] = true
+			work = append(work, name)
+		}
+	}
+	for len(work) > 0 {
+		name := work[len(work)-1]
+		work = work[:len(work)-1]
+		for pred := range g.preds[name] {
+			if !kept[pred] {
+				kept[pred] = true
+				work = append(work, pred)
+			}
+		}
+	}
+
+	c := &cycleGraph{kept: kept}
+	ids := make(map[string]int)
+	for _, name := range g.names {
+		if kept[name] {
+			ids[name] = len(c.names)
+			c.names = append(c.names, name)
+		}
+	}
+	c.n = len(c.names)
+	c.start, c.end = c.n, c.n+1
+	c.names = append(c.names, "", "")
+	c.out = make([][]int, len(c.names))
+	c.inc = make([][]int, len(c.names))
+	if kept[g.entry] {
+		c.addEdge(c.start, ids[g.entry])
+	}
+	for _, name := range c.names[:c.n] {
+		if len(g.succs[name]) == 0 {
+			c.addEdge(ids[name], c.end)
+			continue
+		}
+		for _, succ := range sorted(g.succs[name]) {
+			if kept[succ] {
+				c.addEdge(ids[name], ids[succ])
+			}
+		}
+	}
+	c.addEdge(c.end, c.start)
+	c.out[c.end] = nil
+	return c
+}
+
+// addEdge adds an edge from the node src to the node dst.
+func (c *cycleGraph) addEdge(src, dst int) {
+	e := len(c.edges)
+	c.edges = append(c.edges, cycleEdge{src: src, dst: dst})
+	c.out[src] = append(c.out[src], e)
+	if src != dst {
+		c.inc[src] = append(c.inc[src], e)
+		c.inc[dst] = append(c.inc[dst], e)
+	}
+}
+
+// edge returns the control flow graph edge of the given edge ID.
+func (c *cycleGraph) edge(e int) Edge {
+	return Edge{Src: c.names[c.edges[e].src], Dst: c.names[c.edges[e].dst]}
+}
+
+// classes partitions the edges of the cycle graph into cycle equivalence
+// classes, and returns the class of each edge ID. Two edges are cycle
+// equivalent if every cycle which contains one of the edges also contains the
+// other. As the graph is strongly connected, the edges are cycle equivalent if
+// and only if they are cycle equivalent in the undirected graph; which is
+// computed in linear time using the bracket lists of Johnson, Pearson and
+// Pingali.
+func (c *cycleGraph) classes() []int {
+	class := make([]int, len(c.edges))
+	for e := range class {
+		class[e] = -1
+	}
+	nclasses := 0
+	newClass := func() int {
+		nclasses++
+		return nclasses - 1
+	}
+
+	// Self-loops are only cycle equivalent with themselves.
+	for e, edge := range c.edges {
+		if edge.src == edge.dst {
+			class[e] = newClass()
+		}
+	}
+
+	// Undirected depth-first traversal from the start node. The edges which are
+	// not part of the spanning tree are backedges from a descendant to an
+	// ancestor.
+	const undef = -1
+	dfsnum := make([]int, len(c.names))
+	for n := range dfsnum {
+		dfsnum[n] = undef
+	}
+	var order []int
+	parentEdge := make([]int, len(c.names))
+	children := make([][]int, len(c.names))
+	// backedges from each node to its ancestors, and from descendants of each
+	// node to the node.
+	up := make([][]int, len(c.names))
+	down := make([][]int, len(c.names))
+	var visit func(n int)
+	visit = func(n int) {
+		dfsnum[n] = len(order)
+		order = append(order, n)
+		for _, e := range c.inc[n] {
+			if e == parentEdge[n] {
+				continue
+			}
+			other := c.edges[e].src
+			if other == n {
+				other = c.edges[e].dst
+			}
+			switch {
+			case dfsnum[other] == undef:
+				parentEdge[other] = e
+				children[n] = append(children[n], other)
+				visit(other)
+			case dfsnum[other] < dfsnum[n]:
+				up[n] = append(up[n], e)
+				down[other] = append(down[other], e)
+			}
+		}
+	}
+	parentEdge[c.start] = undef
+	visit(c.start)
+
+	// Process the nodes in reverse depth-first order, maintaining the bracket
+	// list of each node; i.e. the backedges from descendants of the node to
+	// ancestors of the node.
+	hi := make([]int, len(c.names))
+	blists := make([]*bracketList, len(c.names))
+	brackets := make(map[int]*bracket)
+	capping := make([][]*bracket, len(c.names))
+	for i := len(order) - 1; i >= 0; i-- {
+		n := order[i]
+		other := func(e int) int {
+			if c.edges[e].src == n {
+				return c.edges[e].dst
+			}
+			return c.edges[e].src
+		}
+		hi0 := len(order)
+		for _, e := range up[n] {
+			if t := dfsnum[other(e)]; t < hi0 {
+				hi0 = t
+			}
+		}
+		hi1, hi2 := len(order), len(order)
+		hichild := undef
+		for _, child := range children[n] {
+			if hi[child] < hi1 {
+				hi1 = hi[child]
+				hichild = child
+			}
+		}
+		for _, child := range children[n] {
+			if child != hichild && hi[child] < hi2 {
+				hi2 = hi[child]
+			}
+		}
+		hi[n] = hi0
+		if hi1 < hi[n] {
+			hi[n] = hi1
+		}
+
+		blist := &bracketList{}
+		for _, child := range children[n] {
+			blist.concat(blists[child])
+		}
+		for _, b := range capping[n] {
+			blist.delete(b)
+		}
+		for _, e := range down[n] {
+			blist.delete(brackets[e])
+			if class[e] == -1 {
+				class[e] = newClass()
+			}
+		}
+		for _, e := range up[n] {
+			b := &bracket{edge: e}
+			brackets[e] = b
+			blist.push(b)
+		}
+		if hi2 < hi0 && hi2 < dfsnum[n] {
+			// Create a capping backedge to the ancestor with the given depth-first
+			// number. Brackets of children which end at the node itself need no
+			// capping backedge.
+			b := &bracket{edge: undef}
+			capping[order[hi2]] = append(capping[order[hi2]], b)
+			blist.push(b)
+		}
+		blists[n] = blist
+
+		// Determine the class of the tree edge from the parent of the node.
+		e := parentEdge[n]
+		if e == undef {
+			continue
+		}
+		b := blist.top()
+		if b == nil {
+			class[e] = newClass()
+			continue
+		}
+		if b.recentSize != blist.size {
+			b.recentSize = blist.size
+			b.recentClass = newClass()
+		}
+		class[e] = b.recentClass
+		if b.recentSize == 1 && b.edge != undef {
+			class[b.edge] = class[e]
+		}
+	}
+	return class
+}
+
+// bracket represents a backedge in a bracket list.
+type bracket struct {
+	// Edge ID of the backedge; -1 for capping backedges.
+	edge int
+	// Size of the bracket list when the bracket was most recently the topmost
+	// bracket, and the cycle equivalence class assigned at that time.
+	recentSize, recentClass int
+	prev, next              *bracket
+}
+
+// bracketList is a doubly linked list of brackets, which supports push, delete
+// and concatenation in constant time.
+type bracketList struct {
+	head, tail *bracket
+	size       int
+}
+
+// push pushes b onto the top of the list.
+func (l *bracketList) push(b *bracket) {
+	b.prev, b.next = l.tail, nil
+	if l.tail != nil {
+		l.tail.next = b
+	} else {
+		l.head = b
+	}
+	l.tail = b
+	l.size++
+}
+
+// top returns the topmost bracket of the list, or nil if the list is empty.
+func (l *bracketList) top() *bracket {
+	return l.tail
+}
+
+// delete removes b from the list.
+func (l *bracketList) delete(b *bracket) {
+	if b.prev != nil {
+		b.prev.next = b.next
+	} else {
+		l.head = b.next
+	}
+	if b.next != nil {
+		b.next.prev = b.prev
+	} else {
+		l.tail = b.prev
+	}
+	b.prev, b.next = nil, nil
+	l.size--
+}
+
+// concat appends the brackets of x to the list.
+func (l *bracketList) concat(x *bracketList) {
+	if x.head == nil {
+		return
+	}
+	if l.tail != nil {
+		l.tail.next = x.head
+		x.head.prev = l.tail
+	} else {
+		l.head = x.head
+	}
+	l.tail = x.tail
+	l.size += x.size
+}
@@ -0,0 +1,174 @@
+package analysis
+
+import (
+	"sort"
+
+	"decomp.org/x/graphs/dom"
+	"github.com/mewfork/dot"
+	"github.com/mewkiz/pkg/errutil"
+)
+
+// An Edge represents a directed edge of a control flow graph.
+type Edge struct {
+	// Node names of the source and destination nodes.
+	Src, Dst string
+}
+
+// A Loop represents a natural loop of a control flow graph; i.e. the header
+// node, which dominates every node of the loop, and the nodes which reach a
+// back edge to the header without passing through the header. Natural loops
+// which share a header are represented by a single loop.
+type Loop struct {
+	// Node name of the loop header.
+	Header string
+	// Sorted node names of the latch nodes of the loop; i.e. the sources of the
+	// back edges to the header.
+	Latches []string
+	// Sorted node names of the loop, including the header and the nodes of
+	// nested loops.
+	Nodes []string
+	// Exit edges of the loop, sorted by source and destination node name; i.e.
+	// the edges from a node of the loop to a node outside of the loop.
+	Exits []Edge
+	// Loops immediately nested within the loop, ordered by header node name.
+	Children []*Loop
+}
+
+// BackEdges returns the back edges of the control flow graph, sorted by source
+// and destination node name. An edge is a back edge if its destination node
+// dominates its source node.
+//
+// Nodes unreachable from the entry node are ignored.
+func BackEdges(graph *dot.Graph) ([]Edge, error) {
+	entry, err := Entry(graph)
+	if err != nil {
+		return nil, errutil.Err(err)
+	}
+	g := newFlowGraph(graph, entry)
+	return g.backEdges(g.domTree()), nil
+}
+
+// backEdges returns the back edges of g, sorted by source and destination node
+// name.
+func (g *flowGraph) backEdges(tree *dom.Tree) []Edge {
+	var edges []Edge
+	for _, name := range g.names {
+		for _, succ := range sorted(g.succs[name]) {
+			if tree.Dominates(succ, name) {
+				edges = append(edges, Edge{Src: name, Dst: succ})
+			}
+		}
+	}
+	return edges
+}
+
+// NaturalLoops returns the loop nesting forest of the control flow graph; i.e.
+// the outermost natural loops of the graph, ordered by header node name, with
+// nested loops as children.
+//
+// Only loops entered through their header are located. Cycles of irreducible
+// graphs which are entered through more than one node have no back edge and
+// are therefore not part of any natural loop; see MultiEntryLoops.
+//
+// Nodes unreachable from the entry node are ignored.
+func NaturalLoops(graph *dot.Graph) ([]*Loop, error) {
+	entry, err := Entry(graph)
+	if err != nil {
+		return nil, errutil.Err(err)
+	}
+	g := newFlowGraph(graph, entry)
+
+	// Group back edges by header.
+	var headers []string
+	latches := make(map[string]map[string]bool)
+	for _, e := range g.backEdges(g.domTree()) {
+		if latches[e.Dst] == nil {
+			headers = append(headers, e.Dst)
+			latches[e.Dst] = make(map[string]bool)
+		}
+		latches[e.Dst][e.Src] = true
+	}
+	sort.Strings(headers)
+
+	// Locate the nodes and exit edges of each loop.
+	var loops []*Loop
+	nodes := make(map[*Loop]map[string]bool)
+	for _, header := range headers {
+		loop := &Loop{Header: header, Latches: sorted(latches[header])}
+		body := g.loopBody(header, latches[header])
+		loop.Nodes = sorted(body)
+		for _, name := range loop.Nodes {
+			for _, succ := range sorted(g.succs[name]) {
+				if !body[succ] {
+					loop.Exits = append(loop.Exits, Edge{Src: name, Dst: succ})
+				}
+			}
+		}
+		loops = append(loops, loop)
+		nodes[loop] = body
+	}
+
+	// Build the loop nesting forest. Two natural loops with distinct headers are
+	// either disjoint or nested, and the parent of a loop is the smallest loop
+	// which contains its header.
+	var roots []*Loop
+	for _, loop := range loops {
+		var parent *Loop
+		for _, l := range loops {
+			if l == loop || !nodes[l][loop.Header] {
+				continue
+			}
+			if parent == nil || len(l.Nodes) < len(parent.Nodes) {
+				parent = l
+			}
+		}
+		if parent == nil {
+			roots = append(roots, loop)
+			continue
+		}
+		parent.Children = append(parent.Children, loop)
+	}
+	return roots, nil
+}
+
+// loopBody returns the nodes of the natural loop with the given header and
+// latch nodes; i.e. the header and the nodes which reach a latch without
+// passing through the header.
+func (g *flowGraph) loopBody(header string, latches map[string]bool) map[string]bool {
+	body := map[string]bool{header: true}
+	var work []string
+	for latch := range latches {
+		if !body[latch] {
+			body[latch] = true
+			work = append(work, latch)
+		}
+	}
+	for len(work) > 0 {
+		name := work[len(work)-1]
+		work = work[:len(work)-1]
+		for pred := range g.preds[name] {
+			if !body[pred] {
+				body[pred] = true
+				work = append(work, pred)
+			}
+		}
+	}
+	return body
+}
+
+// Walk traverses the loop nesting tree rooted at loop in depth-first order,
+// calling f for each loop and its nesting depth, starting with loop at depth 0.
+// If f returns false, the nested loops of the loop are not traversed.
+func (loop *Loop) Walk(f func(l *Loop, depth int) bool) {
+	loop.walk(f, 0)
+}
+
+// walk traverses the loop nesting tree rooted at loop in depth-first order.
+func (loop *Loop) walk(f func(l *Loop, depth int) bool, depth int) {
+	if !f(loop, depth) {
+		return
+	}
+	for _, child := range loop.Children {
+		child.walk(f, depth+1)
+	}
+}
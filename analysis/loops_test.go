@@ -0,0 +1,163 @@
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/mewfork/dot"
+)
+
+// src is the control flow graph of
+//
+//    0: while (a) {
+//    1:    if (b) {
+//             break
+//          }
+//    2:    do {
+//    3:       c
+//          } while (d)
+//    4:    e
+//       }
+//    5: return
+const src = `digraph f {
+	0->1
+	0->5
+	1->5
+	1->2
+	2->3
+	3->2
+	3->4
+	4->0
+	0 [label="entry"]
+	1
+	2
+	3
+	4
+	5
+}`
+
+// unreachable is the control flow graph of a loop which is also entered from a
+// node unreachable from the entry node.
+const unreachable = `digraph f {
+	0 [label="entry"]; 0->1; 1->2; 2->1; 2->3; 9->2
+}`
+
+func TestNaturalLoops(t *testing.T) {
+	golden := []struct {
+		path string
+		src  string
+		back []Edge
+		// Headers and depths of the loop nesting forest in depth-first order.
+		walk  []string
+		loops []*Loop
+	}{
+		// i=0
+		{
+			src:  src,
+			back: []Edge{{Src: "3", Dst: "2"}, {Src: "4", Dst: "0"}},
+			walk: []string{"0:0", "2:1"},
+			loops: []*Loop{
+				{
+					Header:  "0",
+					Latches: []string{"4"},
+					Nodes:   []string{"0", "1", "2", "3", "4"},
+					Exits:   []Edge{{Src: "0", Dst: "5"}, {Src: "1", Dst: "5"}},
+					Children: []*Loop{
+						{
+							Header:  "2",
+							Latches: []string{"3"},
+							Nodes:   []string{"2", "3"},
+							Exits:   []Edge{{Src: "3", Dst: "4"}},
+						},
+					},
+				},
+			},
+		},
+		// i=1
+		{
+			path: "../testdata/infinity_graphs/main.dot",
+			back: []Edge{{Src: "2", Dst: "1"}},
+			walk: []string{"1:0"},
+			loops: []*Loop{
+				{
+					Header:  "1",
+					Latches: []string{"2"},
+					Nodes:   []string{"1", "2"},
+				},
+			},
+		},
+		// i=2
+		{
+			path: "../testdata/irreducible_graphs/nested.dot",
+			back: []Edge{{Src: "3", Dst: "1"}},
+			walk: []string{"1:0"},
+			loops: []*Loop{
+				{
+					Header:  "1",
+					Latches: []string{"3"},
+					Nodes:   []string{"1", "2", "3"},
+					Exits:   []Edge{{Src: "2", Dst: "4"}},
+				},
+			},
+		},
+		// i=3
+		{
+			path: "../testdata/irreducible_graphs/irreducible.dot",
+		},
+		// i=4
+		{
+			src:  unreachable,
+			back: []Edge{{Src: "2", Dst: "1"}},
+			walk: []string{"1:0"},
+			loops: []*Loop{
+				{
+					Header:  "1",
+					Latches: []string{"2"},
+					Nodes:   []string{"1", "2"},
+					Exits:   []Edge{{Src: "2", Dst: "3"}},
+				},
+			},
+		},
+	}
+
+	for i, g := range golden {
+		var graph *dot.Graph
+		var err error
+		if len(g.path) > 0 {
+			graph, err = dot.ParseFile(g.path)
+		} else {
+			graph, err = dot.Read([]byte(g.src))
+		}
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		back, err := BackEdges(graph)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(back, g.back) {
+			t.Errorf("i=%d: back edges mismatch; expected %v, got %v", i, g.back, back)
+		}
+		loops, err := NaturalLoops(graph)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(loops, g.loops) {
+			t.Errorf("i=%d: loops mismatch; expected %v, got %v", i, g.loops, loops)
+		}
+		var walk []string
+		for _, loop := range loops {
+			loop.Walk(func(l *Loop, depth int) bool {
+				walk = append(walk, fmt.Sprintf("%s:%d", l.Header, depth))
+				return true
+			})
+		}
+		if !reflect.DeepEqual(walk, g.walk) {
+			t.Errorf("i=%d: walk mismatch; expected %v, got %v", i, g.walk, walk)
+		}
+	}
+}
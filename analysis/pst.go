@@ -0,0 +1,177 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/mewfork/dot"
+	"github.com/mewkiz/pkg/errutil"
+)
+
+// A PSTNode represents a node of the program structure tree (PST) of a control
+// flow graph [1]; i.e. a canonical single-entry/single-exit region, with the
+// canonical regions immediately nested within it as children. The root of the
+// tree represents the entire graph.
+//
+// [1]: The Program Structure Tree: Computing Control Regions in Linear Time
+//      https://doi.org/10.1145/178243.178258
+type PSTNode struct {
+	// Canonical SESE region; nil for the root of the tree.
+	Region *Region
+	// Sorted node names of the nodes immediately contained within the region;
+	// i.e. the nodes of the region which are not contained within a child
+	// region.
+	Nodes []string
+	// Canonical regions immediately nested within the region, ordered by
+	// entry and exit edge.
+	Children []*PSTNode
+}
+
+// ProgramStructureTree returns the program structure tree of the control flow
+// graph. The canonical SESE regions of the tree are computed in linear time by
+// partitioning the edges of the graph into cycle equivalence classes [1]; the
+// canonical regions are delimited by consecutive edges of a cycle equivalence
+// class, in dominance order.
+//
+// Nodes which cannot reach a node without successors (e.g. nodes of infinite
+// loops) are immediately contained within the root of the tree. Nodes
+// unreachable from the entry node are ignored.
+//
+// [1]: The Program Structure Tree: Computing Control Regions in Linear Time
+//      https://doi.org/10.1145/178243.178258
+func ProgramStructureTree(graph *dot.Graph) (*PSTNode, error) {
+	entry, err := Entry(graph)
+	if err != nil {
+		return nil, errutil.Err(err)
+	}
+	g := newFlowGraph(graph, entry)
+	c := newCycleGraph(g)
+	class := c.classes()
+
+	// Order the edges of each cycle equivalence class by a depth-first
+	// traversal of the graph, which visits the edges of a class in dominance
+	// order.
+	var order []int
+	visited := make([]bool, len(c.names))
+	var visit func(n int)
+	visit = func(n int) {
+		visited[n] = true
+		for _, e := range c.out[n] {
+			order = append(order, e)
+			if dst := c.edges[e].dst; !visited[dst] {
+				visit(dst)
+			}
+		}
+	}
+	visit(c.start)
+	byClass := make(map[int][]int)
+	for _, e := range order {
+		byClass[class[e]] = append(byClass[class[e]], e)
+	}
+
+	// Create the canonical regions between consecutive edges of each class.
+	root := &PSTNode{}
+	entryOf := make(map[int]*PSTNode)
+	exitOf := make(map[int]*PSTNode)
+	for _, es := range byClass {
+		for i := 1; i < len(es); i++ {
+			region := &Region{Entry: c.edge(es[i-1]), Exit: c.edge(es[i])}
+			node := &PSTNode{Region: region}
+			entryOf[es[i-1]] = node
+			exitOf[es[i]] = node
+		}
+	}
+
+	// Nest the regions by a second depth-first traversal, in which the entry
+	// edge of a region is always traversed before its exit edge.
+	parent := make(map[*PSTNode]*PSTNode)
+	for n := range visited {
+		visited[n] = false
+	}
+	var nest func(n int, cur *PSTNode)
+	nest = func(n int, cur *PSTNode) {
+		visited[n] = true
+		if n < c.n {
+			cur.Nodes = append(cur.Nodes, c.names[n])
+		}
+		for _, e := range c.out[n] {
+			r := cur
+			if node, ok := exitOf[e]; ok {
+				r = parent[node]
+			}
+			if node, ok := entryOf[e]; ok {
+				parent[node] = r
+				r = node
+			}
+			if dst := c.edges[e].dst; !visited[dst] {
+				nest(dst, r)
+			}
+		}
+	}
+	nest(c.start, root)
+	for _, name := range g.names {
+		if !c.kept[name] {
+			root.Nodes = append(root.Nodes, name)
+		}
+	}
+	for node, p := range parent {
+		p.Children = append(p.Children, node)
+	}
+	root.finish()
+	return root, nil
+}
+
+// finish sorts the nodes and children of the tree rooted at node, and records
+// the nodes of each region, recursively. It returns the nodes of the tree.
+func (node *PSTNode) finish() []string {
+	sort.Strings(node.Nodes)
+	sort.Sort(byRegion(node.Children))
+	nodes := append([]string(nil), node.Nodes...)
+	for _, child := range node.Children {
+		nodes = append(nodes, child.finish()...)
+	}
+	sort.Strings(nodes)
+	if node.Region != nil {
+		node.Region.Nodes = nodes
+	}
+	return nodes
+}
+
+// Walk traverses the tree rooted at node in depth-first order, calling f for
+// each node and its depth in the tree, starting with node at depth 0. If f
+// returns false, the children of the node are not traversed.
+func (node *PSTNode) Walk(f func(n *PSTNode, depth int) bool) {
+	node.walk(f, 0)
+}
+
+// walk traverses the tree rooted at node in depth-first order.
+func (node *PSTNode) walk(f func(n *PSTNode, depth int) bool, depth int) {
+	if !f(node, depth) {
+		return
+	}
+	for _, child := range node.Children {
+		child.walk(f, depth+1)
+	}
+}
+
+// byRegion implements sort.Interface, sorting tree nodes by the entry and exit
+// edge of their regions.
+type byRegion []*PSTNode
+
+func (ns byRegion) Len() int      { return len(ns) }
+func (ns byRegion) Swap(i, j int) { ns[i], ns[j] = ns[j], ns[i] }
+func (ns byRegion) Less(i, j int) bool {
+	a, b := ns[i].Region, ns[j].Region
+	if a.Entry != b.Entry {
+		return edgeLess(a.Entry, b.Entry)
+	}
+	return edgeLess(a.Exit, b.Exit)
+}
+
+// edgeLess reports whether the edge a is ordered before the edge b, by source
+// and destination node name.
+func edgeLess(a, b Edge) bool {
+	if a.Src != b.Src {
+		return a.Src < b.Src
+	}
+	return a.Dst < b.Dst
+}
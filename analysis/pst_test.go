@@ -0,0 +1,77 @@
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/mewfork/dot"
+)
+
+func TestProgramStructureTree(t *testing.T) {
+	graph, err := dot.Read([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := ProgramStructureTree(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	root.Walk(func(n *PSTNode, depth int) bool {
+		got = append(got, fmt.Sprintf("%d: %v %q", depth, n.Region, n.Nodes))
+		return true
+	})
+	want := []string{
+		`0: <nil> []`,
+		`1: &{{ 0} {5 } [0 1 2 3 4 5]} ["0" "1" "5"]`,
+		`2: &{{1 2} {3 4} [2 3]} ["2" "3"]`,
+		`2: &{{3 4} {4 0} [4]} ["4"]`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("program structure tree mismatch; expected %q, got %q", want, got)
+	}
+}
+
+func TestProgramStructureTreeRegions(t *testing.T) {
+	// The canonical regions of the program structure tree are the same as those
+	// given by the definition of canonical SESE regions.
+	graphPaths := []string{
+		"../testdata/c4_graphs/expr.dot",
+		"../testdata/c4_graphs/main.dot",
+		"../testdata/c4_graphs/next.dot",
+		"../testdata/c4_graphs/stmt.dot",
+		"../testdata/infinity_graphs/main.dot",
+		"../testdata/irreducible_graphs/irreducible.dot",
+		"../testdata/irreducible_graphs/nested.dot",
+	}
+	for _, graphPath := range graphPaths {
+		graph, err := dot.ParseFile(graphPath)
+		if err != nil {
+			t.Errorf("%s: %v", graphPath, err)
+			continue
+		}
+		want, err := canonicalRegions(graph)
+		if err != nil {
+			t.Errorf("%s: %v", graphPath, err)
+			continue
+		}
+		root, err := ProgramStructureTree(graph)
+		if err != nil {
+			t.Errorf("%s: %v", graphPath, err)
+			continue
+		}
+		var got []*Region
+		root.Walk(func(n *PSTNode, depth int) bool {
+			if n.Region != nil {
+				got = append(got, n.Region)
+			}
+			return true
+		})
+		sort.Sort(byEntryExit(got))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: regions mismatch; expected %v, got %v", graphPath, want, got)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package analysis
+
+import (
+	"github.com/mewfork/dot"
+	"github.com/mewkiz/pkg/errutil"
+)
+
+// IsReducible reports whether the control flow graph is reducible, by applying
+// the T1 and T2 transformations until no further transformation is possible.
+// The graph is reducible if it is reduced to a single node.
+//
+//    T1: remove the self-loop of a node.
+//    T2: merge a node with a unique predecessor into its predecessor.
+//
+// Nodes unreachable from the entry node are ignored.
+func IsReducible(graph *dot.Graph) (bool, error) {
+	entry, err := Entry(graph)
+	if err != nil {
+		return false, errutil.Err(err)
+	}
+	g := newFlowGraph(graph, entry)
+	for changed := true; changed; {
+		changed = false
+		// Node names are sorted, which makes the algorithm deterministic.
+		for _, name := range g.names {
+			if _, ok := g.succs[name]; !ok {
+				// Merged by T2.
+				continue
+			}
+			// T1 transformation.
+			if g.succs[name][name] {
+				delete(g.succs[name], name)
+				delete(g.preds[name], name)
+				changed = true
+			}
+			// T2 transformation.
+			if name == g.entry || len(g.preds[name]) != 1 {
+				continue
+			}
+			pred := sorted(g.preds[name])[0]
+			for succ := range g.succs[name] {
+				delete(g.preds[succ], name)
+				g.preds[succ][pred] = true
+				g.succs[pred][succ] = true
+			}
+			delete(g.succs[pred], name)
+			delete(g.succs, name)
+			delete(g.preds, name)
+			changed = true
+		}
+	}
+	return len(g.succs) == 1, nil
+}
+
+// A MultiEntryLoop represents a strongly connected region of a control flow
+// graph with more than one entry node, which renders the graph irreducible.
+type MultiEntryLoop struct {
+	// Sorted node names of the loop.
+	Nodes []string
+	// Sorted node names of the entry nodes of the loop; i.e. the nodes of the
+	// loop with a predecessor outside of the loop.
+	Entries []string
+}
+
+// MultiEntryLoops returns the loops of the control flow graph with more than
+// one entry node, ordered by their first node name. The graph is reducible if
+// and only if it contains no such loops.
+//
+// Loops are located by decomposing the graph into strongly connected
+// components. The edges to the entry nodes of each component are removed and
+// the remaining nodes of the component are decomposed recursively, which
+// locates nested loops.
+//
+// Nodes unreachable from the entry node are ignored.
+func MultiEntryLoops(graph *dot.Graph) ([]*MultiEntryLoop, error) {
+	entry, err := Entry(graph)
+	if err != nil {
+		return nil, errutil.Err(err)
+	}
+	g := newFlowGraph(graph, entry)
+	var loops []*MultiEntryLoop
+	nodes := make(map[string]bool)
+	for _, name := range g.names {
+		nodes[name] = true
+	}
+	g.multiEntryLoops(nodes, &loops)
+	return loops, nil
+}
+
+// multiEntryLoops appends the multi-entry loops within the given set of nodes
+// to loops.
+func (g *flowGraph) multiEntryLoops(nodes map[string]bool, loops *[]*MultiEntryLoop) {
+	for _, scc := range g.sccs(nodes) {
+		// Ignore trivial components without a self-loop.
+		if len(scc) == 1 {
+			if name := sorted(scc)[0]; !g.succs[name][name] {
+				continue
+			}
+		}
+
+		// Locate the entry nodes of the component.
+		entries := make(map[string]bool)
+		for name := range scc {
+			if name == g.entry {
+				entries[name] = true
+			}
+			for pred := range g.preds[name] {
+				if !scc[pred] {
+					entries[name] = true
+				}
+			}
+		}
+		if len(entries) > 1 {
+			*loops = append(*loops, &MultiEntryLoop{Nodes: sorted(scc), Entries: sorted(entries)})
+		}
+
+		// Decompose the component without the edges to its entry nodes.
+		inner := make(map[string]bool)
+		for name := range scc {
+			if !entries[name] {
+				inner[name] = true
+			}
+		}
+		g.multiEntryLoops(inner, loops)
+	}
+}
+
+// sccs returns the strongly connected components of the subgraph induced by
+// the given set of nodes, using Tarjan's algorithm. The components are ordered
+// by their first node name.
+func (g *flowGraph) sccs(nodes map[string]bool) []map[string]bool {
+	t := &tarjan{
+		g:       g,
+		nodes:   nodes,
+		index:   make(map[string]int),
+		lowlink: make(map[string]int),
+		onStack: make(map[string]bool),
+	}
+	// Node names are sorted, which makes the algorithm deterministic.
+	for _, name := range sorted(nodes) {
+		if _, ok := t.index[name]; !ok {
+			t.visit(name)
+		}
+	}
+
+	// Order components by their first node name.
+	first := func(scc map[string]bool) string {
+		return sorted(scc)[0]
+	}
+	for i := 1; i < len(t.sccs); i++ {
+		for j := i; j > 0 && first(t.sccs[j]) < first(t.sccs[j-1]); j-- {
+			t.sccs[j], t.sccs[j-1] = t.sccs[j-1], t.sccs[j]
+		}
+	}
+	return t.sccs
+}
+
+// tarjan tracks the state of Tarjan's strongly connected components algorithm.
+type tarjan struct {
+	g       *flowGraph
+	nodes   map[string]bool
+	n       int
+	index   map[string]int
+	lowlink map[string]int
+	stack   []string
+	onStack map[string]bool
+	sccs    []map[string]bool
+}
+
+// visit visits the node of the given name and its unvisited successors.
+func (t *tarjan) visit(name string) {
+	t.index[name] = t.n
+	t.lowlink[name] = t.n
+	t.n++
+	t.stack = append(t.stack, name)
+	t.onStack[name] = true
+	for _, succ := range sorted(t.g.succs[name]) {
+		if !t.nodes[succ] {
+			continue
+		}
+		if _, ok := t.index[succ]; !ok {
+			t.visit(succ)
+			if t.lowlink[succ] < t.lowlink[name] {
+				t.lowlink[name] = t.lowlink[succ]
+			}
+		} else if t.onStack[succ] && t.index[succ] < t.lowlink[name] {
+			t.lowlink[name] = t.index[succ]
+		}
+	}
+	if t.lowlink[name] != t.index[name] {
+		return
+	}
+	scc := make(map[string]bool)
+	for {
+		n := len(t.stack) - 1
+		top := t.stack[n]
+		t.stack = t.stack[:n]
+		t.onStack[top] = false
+		scc[top] = true
+		if top == name {
+			break
+		}
+	}
+	t.sccs = append(t.sccs, scc)
+}
@@ -0,0 +1,76 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mewfork/dot"
+)
+
+func TestIsReducible(t *testing.T) {
+	golden := []struct {
+		path  string
+		src   string
+		want  bool
+		loops []*MultiEntryLoop
+	}{
+		// i=0
+		{path: "../testdata/c4_graphs/expr.dot", want: true},
+		// i=1
+		{path: "../testdata/c4_graphs/main.dot", want: true},
+		// i=2
+		{path: "../testdata/c4_graphs/next.dot", want: true},
+		// i=3
+		{path: "../testdata/c4_graphs/stmt.dot", want: true},
+		// i=4
+		{path: "../testdata/infinity_graphs/main.dot", want: true},
+		// i=5
+		{
+			path: "../testdata/irreducible_graphs/irreducible.dot",
+			want: false,
+			loops: []*MultiEntryLoop{
+				{Nodes: []string{"1", "2"}, Entries: []string{"1", "2"}},
+			},
+		},
+		// i=6
+		{
+			path: "../testdata/irreducible_graphs/nested.dot",
+			want: false,
+			loops: []*MultiEntryLoop{
+				{Nodes: []string{"2", "3"}, Entries: []string{"2", "3"}},
+			},
+		},
+		// i=7
+		{src: unreachable, want: true},
+	}
+
+	for i, g := range golden {
+		var graph *dot.Graph
+		var err error
+		if len(g.path) > 0 {
+			graph, err = dot.ParseFile(g.path)
+		} else {
+			graph, err = dot.Read([]byte(g.src))
+		}
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		got, err := IsReducible(graph)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		if got != g.want {
+			t.Errorf("i=%d: reducibility mismatch; expected %v, got %v", i, g.want, got)
+		}
+		loops, err := MultiEntryLoops(graph)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(loops, g.loops) {
+			t.Errorf("i=%d: multi-entry loops mismatch; expected %v, got %v", i, g.loops, loops)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/mewfork/dot"
+	"github.com/mewkiz/pkg/errutil"
+)
+
+// A Region represents a single-entry/single-exit (SESE) region of a control
+// flow graph, as defined by Johnson, Pearson and Pingali [1]. The region is
+// delimited by an entry edge and an exit edge, such that the entry edge
+// dominates the exit edge, the exit edge post-dominates the entry edge, and
+// every cycle which contains one of the edges also contains the other.
+//
+// The graph is augmented with a virtual start node, which has an edge to the
+// entry node, and a virtual end node, which has an edge from each node without
+// successors. The virtual nodes are represented by empty node names.
+//
+// [1]: The Program Structure Tree: Computing Control Regions in Linear Time
+//      https://doi.org/10.1145/178243.178258
+type Region struct {
+	// Entry and exit edges of the region.
+	Entry, Exit Edge
+	// Sorted node names of the region; i.e. the nodes dominated by the entry
+	// edge and post-dominated by the exit edge.
+	Nodes []string
+}
+
+// SESERegions returns the canonical single-entry/single-exit regions of the
+// control flow graph, sorted by entry and exit edge. A SESE region is canonical
+// if its exit edge dominates the exit edges of all other SESE regions with the
+// same entry edge, and its entry edge post-dominates the entry edges of all
+// other SESE regions with the same exit edge. Canonical regions are either
+// disjoint or nested.
+//
+// The canonical regions are those of the program structure tree of the graph,
+// which are computed in linear time; see ProgramStructureTree.
+//
+// Nodes which cannot reach a node without successors (e.g. nodes of infinite
+// loops) are not part of any region. Nodes unreachable from the entry node are
+// ignored.
+func SESERegions(graph *dot.Graph) ([]*Region, error) {
+	root, err := ProgramStructureTree(graph)
+	if err != nil {
+		return nil, errutil.Err(err)
+	}
+	var regions []*Region
+	root.Walk(func(n *PSTNode, depth int) bool {
+		if n.Region != nil {
+			regions = append(regions, n.Region)
+		}
+		return true
+	})
+	sort.Sort(byEntryExit(regions))
+	return regions, nil
+}
+
+// byEntryExit implements sort.Interface, sorting regions by entry and exit
+// edge.
+type byEntryExit []*Region
+
+func (rs byEntryExit) Len() int      { return len(rs) }
+func (rs byEntryExit) Swap(i, j int) { rs[i], rs[j] = rs[j], rs[i] }
+func (rs byEntryExit) Less(i, j int) bool {
+	if rs[i].Entry != rs[j].Entry {
+		return edgeLess(rs[i].Entry, rs[j].Entry)
+	}
+	return edgeLess(rs[i].Exit, rs[j].Exit)
+}
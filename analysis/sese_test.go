@@ -0,0 +1,247 @@
+package analysis
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"decomp.org/x/graphs/dom"
+	"github.com/mewfork/dot"
+)
+
+func TestSESERegions(t *testing.T) {
+	golden := []struct {
+		path string
+		src  string
+		want []*Region
+	}{
+		// i=0
+		{
+			src: src,
+			want: []*Region{
+				{Entry: Edge{Dst: "0"}, Exit: Edge{Src: "5"}, Nodes: []string{"0", "1", "2", "3", "4", "5"}},
+				{Entry: Edge{Src: "1", Dst: "2"}, Exit: Edge{Src: "3", Dst: "4"}, Nodes: []string{"2", "3"}},
+				{Entry: Edge{Src: "3", Dst: "4"}, Exit: Edge{Src: "4", Dst: "0"}, Nodes: []string{"4"}},
+			},
+		},
+		// i=1
+		{
+			path: "../testdata/irreducible_graphs/nested.dot",
+			want: []*Region{
+				{Entry: Edge{Dst: "0"}, Exit: Edge{Src: "0", Dst: "1"}, Nodes: []string{"0"}},
+				{Entry: Edge{Src: "0", Dst: "1"}, Exit: Edge{Src: "2", Dst: "4"}, Nodes: []string{"1", "2", "3"}},
+				{Entry: Edge{Src: "2", Dst: "4"}, Exit: Edge{Src: "4"}, Nodes: []string{"4"}},
+			},
+		},
+		// i=2
+		{
+			// Nodes of infinite loops are not part of any region.
+			path: "../testdata/infinity_graphs/main.dot",
+		},
+	}
+
+	for i, g := range golden {
+		var graph *dot.Graph
+		var err error
+		if len(g.path) > 0 {
+			graph, err = dot.ParseFile(g.path)
+		} else {
+			graph, err = dot.Read([]byte(g.src))
+		}
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		got, err := SESERegions(graph)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, g.want) {
+			t.Errorf("i=%d: regions mismatch; expected %v, got %v", i, g.want, got)
+		}
+	}
+}
+
+func TestSESERegionsNodeNames(t *testing.T) {
+	// Node names which contain "->"; the edges (a, "b->c") and ("a->b", c) are
+	// distinct.
+	graph := dot.NewGraph()
+	graph.SetName("f")
+	graph.AddNode("f", "a", map[string]string{"label": "entry"})
+	graph.AddEdge("a", "", "a->b", "", true, nil)
+	graph.AddEdge("a", "", "b->c", "", true, nil)
+	graph.AddEdge("a->b", "", "c", "", true, nil)
+	graph.AddEdge("b->c", "", "c", "", true, nil)
+	want := []*Region{
+		{Entry: Edge{Dst: "a"}, Exit: Edge{Src: "c"}, Nodes: []string{"a", "a->b", "b->c", "c"}},
+		{Entry: Edge{Src: "a", Dst: "a->b"}, Exit: Edge{Src: "a->b", Dst: "c"}, Nodes: []string{"a->b"}},
+		{Entry: Edge{Src: "a", Dst: "b->c"}, Exit: Edge{Src: "b->c", Dst: "c"}, Nodes: []string{"b->c"}},
+	}
+	got, err := SESERegions(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("regions mismatch; expected %v, got %v", want, got)
+	}
+	got, err = canonicalRegions(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("regions mismatch of definition; expected %v, got %v", want, got)
+	}
+}
+
+// canonicalRegions returns the canonical SESE regions of the control flow graph,
+// sorted by entry and exit edge, as given by their definition; i.e. by testing
+// the dominance, post-dominance and cycle equivalence of every pair of edges.
+func canonicalRegions(graph *dot.Graph) ([]*Region, error) {
+	entry, err := Entry(graph)
+	if err != nil {
+		return nil, err
+	}
+	g := newFlowGraph(graph, entry)
+	x := newEdgeGraph(g)
+
+	// Locate the SESE regions.
+	sese := make(map[int]map[int]bool)
+	for a := range x.edges {
+		for b := range x.edges {
+			if a == b || !x.dom.Dominates(x.name(a), x.name(b)) || !x.pdom.Dominates(x.name(b), x.name(a)) {
+				continue
+			}
+			if x.hasCycle(a, b) || x.hasCycle(b, a) {
+				continue
+			}
+			if sese[a] == nil {
+				sese[a] = make(map[int]bool)
+			}
+			sese[a][b] = true
+		}
+	}
+
+	// Keep the canonical regions.
+	var regions []*Region
+	for a := range x.edges {
+		for b := range x.edges {
+			if !sese[a][b] || !x.isCanonical(sese, a, b) {
+				continue
+			}
+			region := &Region{Entry: x.edges[a], Exit: x.edges[b]}
+			for _, name := range g.names {
+				if x.dom.Dominates(x.name(a), "n:"+name) && x.pdom.Dominates(x.name(b), "n:"+name) {
+					region.Nodes = append(region.Nodes, name)
+				}
+			}
+			regions = append(regions, region)
+		}
+	}
+	return regions, nil
+}
+
+// isCanonical reports whether the SESE region delimited by the edges a and b is
+// canonical, given the set of exit edges of the SESE regions of each entry
+// edge.
+func (x *edgeGraph) isCanonical(sese map[int]map[int]bool, a, b int) bool {
+	for c := range sese[a] {
+		if !x.dom.Dominates(x.name(b), x.name(c)) {
+			return false
+		}
+	}
+	for c, exits := range sese {
+		if exits[b] && !x.pdom.Dominates(x.name(a), x.name(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// edgeGraph is a control flow graph augmented with virtual start and end nodes,
+// in which each edge is split by an edge node; which enables the dominance of
+// edges to be computed. The node names of the original nodes are prefixed with
+// "n:" and the edge nodes are named by edge ID with an "e:" prefix.
+type edgeGraph struct {
+	// Edges of the control flow graph, including edges from the virtual start
+	// node and to the virtual end node, sorted by source and destination node
+	// name.
+	edges []Edge
+	// Dominator and post-dominator trees.
+	dom, pdom *dom.Tree
+	// Successors of each node, including an edge from the virtual end node to
+	// the virtual start node.
+	succs map[string][]string
+}
+
+// newEdgeGraph returns the edge graph of g.
+func newEdgeGraph(g *flowGraph) *edgeGraph {
+	x := &edgeGraph{succs: make(map[string][]string)}
+	x.edges = append(x.edges, Edge{Dst: g.entry})
+	for _, name := range g.names {
+		if len(g.succs[name]) == 0 {
+			x.edges = append(x.edges, Edge{Src: name})
+			continue
+		}
+		for _, succ := range sorted(g.succs[name]) {
+			x.edges = append(x.edges, Edge{Src: name, Dst: succ})
+		}
+	}
+
+	graph := dot.NewGraph()
+	graph.SetName("edges")
+	graph.AddNode("edges", "start", nil)
+	graph.AddNode("edges", "end", nil)
+	for _, name := range g.names {
+		graph.AddNode("edges", "n:"+name, nil)
+	}
+	for e, edge := range x.edges {
+		name := x.name(e)
+		src, dst := nodeName(edge.Src, "start"), nodeName(edge.Dst, "end")
+		graph.AddNode("edges", name, nil)
+		graph.AddEdge(src, "", name, "", true, nil)
+		graph.AddEdge(name, "", dst, "", true, nil)
+		x.succs[src] = append(x.succs[src], name)
+		x.succs[name] = append(x.succs[name], dst)
+	}
+	x.succs["end"] = append(x.succs["end"], "start")
+	x.dom = dom.New(graph)
+	x.pdom = dom.NewPost(graph)
+	return x
+}
+
+// name returns the node name of the edge node of the given edge ID.
+func (x *edgeGraph) name(e int) string {
+	return "e:" + strconv.Itoa(e)
+}
+
+// hasCycle reports whether there exists a cycle which contains the edge a but
+// not the edge b.
+func (x *edgeGraph) hasCycle(a, b int) bool {
+	src, avoid := x.name(a), x.name(b)
+	visited := map[string]bool{avoid: true}
+	work := []string{src}
+	for len(work) > 0 {
+		name := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, succ := range x.succs[name] {
+			if succ == src {
+				return true
+			}
+			if !visited[succ] {
+				visited[succ] = true
+				work = append(work, succ)
+			}
+		}
+	}
+	return false
+}
+
+// nodeName returns the node name in the edge graph of the given original node
+// name, or virtual if the name is empty.
+func nodeName(name, virtual string) string {
+	if len(name) == 0 {
+		return virtual
+	}
+	return "n:" + name
+}
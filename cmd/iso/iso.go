@@ -7,27 +7,60 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"time"
 
 	"decomp.org/x/graphs"
 	"decomp.org/x/graphs/iso"
+	"decomp.org/x/graphs/patterns"
 	"github.com/mewfork/dot"
 	"github.com/mewkiz/pkg/errutil"
-	"github.com/mewkiz/pkg/goutil"
 	"github.com/mewkiz/pkg/osutil"
 )
 
-// When flagStart is a non-empty string, locate an isomorphism of the subgraph
-// in the graph which starts at the given node.
-var flagStart string
+var (
+	// When flagAll is true, locate all isomorphisms of the subgraph in the graph;
+	// including those which only differ by an automorphism of the subgraph.
+	flagAll bool
+	// When flagExplain is true, report for each entry node why an isomorphism
+	// of the subgraph could or could not be located.
+	flagExplain bool
+	// When flagJSON is true, output isomorphisms as a stream of JSON encoded
+	// matches; see jsonMatch.
+	flagJSON bool
+	// When flagLabels is true, require edge labels of the subgraph to match the
+	// edge labels of the graph.
+	flagLabels bool
+	// flagPatterns specifies the directories searched for the pattern of the
+	// subgraph before the standard patterns, separated by os.PathListSeparator.
+	flagPatterns string
+	// When flagSESE is true, require isomorphisms to be single-entry/single-exit
+	// regions of the graph.
+	flagSESE bool
+	// When flagStart is a non-empty string, locate an isomorphism of the
+	// subgraph in the graph which starts at the given node.
+	flagStart string
+	// When flagTimeout is non-zero, abort the search after the given duration.
+	flagTimeout time.Duration
+)
 
 func init() {
+	flag.BoolVar(&flagAll, "all", false, "Locate all isomorphisms of SUB in GRAPH, including those which only differ by an automorphism of SUB.")
+	flag.BoolVar(&flagExplain, "explain", false, "Report for each entry node of GRAPH why an isomorphism of SUB could or could not be located.")
+	flag.BoolVar(&flagJSON, "json", false, "Output isomorphisms as a stream of JSON encoded matches. A match is a primitive without a node name, as isomorphisms are not merged.")
+	flag.BoolVar(&flagLabels, "labels", false, "Require edge labels of SUB to match edge labels of GRAPH.")
+	flag.StringVar(&flagPatterns, "patterns", "", "Directories searched for the pattern SUB before the standard patterns, separated by the OS path list separator.")
+	flag.BoolVar(&flagSESE, "sese", false, "Require isomorphisms to be single-entry/single-exit regions of GRAPH.")
 	flag.StringVar(&flagStart, "start", "", "Locate an isomorphism of SUB in GRAPH which starts at the given node.")
+	flag.DurationVar(&flagTimeout, "timeout", 0, "Abort the search after the given duration (e.g. 10s).")
 	flag.Usage = usage
 }
 
@@ -64,55 +97,99 @@ func locate(graphPath, subPath string) error {
 		return errutil.Err(err)
 	}
 
-	// Search for subgraph in GOPATH if not found.
-	if ok, _ := osutil.Exists(subPath); !ok {
-		dir, err := goutil.SrcDir("decomp.org/x/graphs/testdata/primitives")
-		if err != nil {
-			return errutil.Err(err)
-		}
-		subPath = filepath.Join(dir, subPath)
+	// Look up subgraph in the pattern library if not found.
+	var sub *graphs.SubGraph
+	if ok, _ := osutil.Exists(subPath); ok {
+		sub, err = graphs.ParseSubGraph(subPath)
+	} else {
+		lib := patterns.New(filepath.SplitList(flagPatterns)...)
+		sub, err = lib.Lookup(strings.TrimSuffix(subPath, ".dot"))
 	}
-	sub, err := graphs.ParseSubGraph(subPath)
 	if err != nil {
 		return errutil.Err(err)
 	}
 
 	// Locate isomorphisms.
+	matcher := iso.Matcher{Labels: flagLabels, All: flagAll, SESE: flagSESE}
+	if flagExplain {
+		explain(matcher, graph, sub)
+		return nil
+	}
 	found := false
 	if len(flagStart) > 0 {
 		// Locate an isomorphism of sub in graph which starts at the node
 		// specified by the "-start" flag.
-		m, ok := iso.Isomorphism(graph, flagStart, sub)
+		match, ok := matcher.Isomorphism(graph, flagStart, sub)
 		if ok {
 			found = true
-			printMapping(graph, sub, m)
+			if err := printMatch(graph, sub, match); err != nil {
+				return errutil.Err(err)
+			}
 		}
 	} else {
-		// Locate all isomorphisms of sub in graph.
-		var names []string
-		for name := range graph.Nodes.Lookup {
-			names = append(names, name)
+		// Locate all isomorphisms of sub in graph, searching the entry nodes
+		// concurrently.
+		ctx := context.Background()
+		if flagTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, flagTimeout)
+			defer cancel()
 		}
-		sort.Strings(names)
-		for _, name := range names {
-			m, ok := iso.Isomorphism(graph, name, sub)
-			if !ok {
-				continue
-			}
+		matches, err := matcher.SearchAllContext(ctx, graph, sub)
+		if err != nil {
+			return errutil.Err(err)
+		}
+		for _, match := range matches {
 			found = true
-			printMapping(graph, sub, m)
+			if err := printMatch(graph, sub, match); err != nil {
+				return errutil.Err(err)
+			}
 		}
 	}
-	if !found {
+	if !found && !flagJSON {
 		fmt.Println("not found.")
 	}
 
 	return nil
 }
 
-// printMapping prints the mapping from sub node name to graph node name for an
-// isomorphism of sub in graph.
-func printMapping(graph *dot.Graph, sub *graphs.SubGraph, m map[string]string) {
+// explain prints, for the entry node specified by the "-start" flag or for
+// every entry node of graph, why an isomorphism of sub could or could not be
+// located.
+func explain(matcher iso.Matcher, graph *dot.Graph, sub *graphs.SubGraph) {
+	var es []*iso.Explanation
+	if len(flagStart) > 0 {
+		es = append(es, matcher.Explain(graph, flagStart, sub))
+	} else {
+		es = matcher.ExplainAll(graph, sub)
+	}
+	for _, e := range es {
+		fmt.Println(e)
+	}
+}
+
+// jsonMatch is the JSON representation of an isomorphism output by the "-json"
+// flag. It has the fields of primitive.Primitive except for the node name, as
+// isomorphisms are not merged into nodes.
+type jsonMatch struct {
+	// Primitive name; e.g. "if", "pre_loop", ...
+	Prim string `json:"prim"`
+	// Node mapping; e.g. {"A": 1, "B": 2, "C": 3}
+	Nodes map[string]string `json:"nodes"`
+}
+
+// enc encodes the matches output by the "-json" flag.
+var enc = json.NewEncoder(os.Stdout)
+
+// printMatch prints the mapping from sub node name to graph node name for an
+// isomorphism of sub in graph, followed by the sub nodes with an inverted
+// branch polarity. If the "-json" flag is set, the isomorphism is instead
+// printed as a JSON encoded match.
+func printMatch(graph *dot.Graph, sub *graphs.SubGraph, match *iso.Match) error {
+	m := match.Nodes
+	if flagJSON {
+		return enc.Encode(&jsonMatch{Prim: sub.Name, Nodes: m})
+	}
 	entry := m[sub.Entry()]
 	var snames []string
 	for sname := range m {
@@ -123,4 +200,10 @@ func printMapping(graph *dot.Graph, sub *graphs.SubGraph, m map[string]string) {
 	for _, sname := range snames {
 		fmt.Printf("   %q=%q\n", sname, m[sname])
 	}
+	for _, sname := range snames {
+		if match.Inverted[sname] {
+			fmt.Printf("   inverted branch polarity at %q\n", sname)
+		}
+	}
+	return nil
 }
@@ -4,5 +4,12 @@
 //
 // Flags:
 //
-//     -start="": Locate an isomorphism of SUB in GRAPH which starts at the given node.
+//     -all=false:     Locate all isomorphisms of SUB in GRAPH, including those which only differ by an automorphism of SUB.
+//     -explain=false: Report for each entry node of GRAPH why an isomorphism of SUB could or could not be located.
+//     -json=false:    Output isomorphisms as a stream of JSON encoded matches. A match is a primitive without a node name, as isomorphisms are not merged.
+//     -labels=false:  Require edge labels of SUB to match edge labels of GRAPH.
+//     -patterns="":   Directories searched for the pattern SUB before the standard patterns, separated by the OS path list separator.
+//     -sese=false:    Require isomorphisms to be single-entry/single-exit regions of GRAPH.
+//     -start="":      Locate an isomorphism of SUB in GRAPH which starts at the given node.
+//     -timeout=0:     Abort the search after the given duration (e.g. 10s).
 package main
@@ -8,6 +8,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -16,13 +17,17 @@ import (
 	"os/exec"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 
 	"decomp.org/x/graphs"
+	"decomp.org/x/graphs/dom"
 	"decomp.org/x/graphs/iso"
 	"decomp.org/x/graphs/merge"
+	"decomp.org/x/graphs/patterns"
+	"decomp.org/x/graphs/primitive"
 	"github.com/mewfork/dot"
 	"github.com/mewkiz/pkg/errutil"
-	"github.com/mewkiz/pkg/goutil"
 	"github.com/mewkiz/pkg/osutil"
 	"github.com/mewkiz/pkg/pathutil"
 )
@@ -30,26 +35,48 @@ import (
 var (
 	// When flagImage is true, generate an image representation of the CFG.
 	flagImage bool
+	// When flagJSON is true, output merged isomorphisms as a stream of JSON
+	// encoded primitives.
+	flagJSON bool
+	// When flagLabels is true, require edge labels of the subgraph to match the
+	// edge labels of the graph.
+	flagLabels bool
 	// flagOut specifies the output path of the graph.
 	flagOut string
+	// flagPatterns specifies the directories searched for the patterns of the
+	// subgraphs before the standard patterns, separated by os.PathListSeparator.
+	flagPatterns string
 	// When flagQuiet is true, suppress non-error messages.
 	flagQuiet bool
-	// When flagStart is a non-empty string, merge an isomorphism of the subgraph
-	// in the graph which starts at the given node.
+	// flagSet specifies the path of a pattern-set file, which lists the
+	// subgraphs and their priorities.
+	flagSet string
+	// When flagStart is a non-empty string, merge an isomorphism of the highest
+	// priority subgraph in the graph which starts at the given node.
 	flagStart string
 )
 
 func init() {
 	flag.BoolVar(&flagImage, "img", false, "Generate an image representation of the CFG.")
+	flag.BoolVar(&flagJSON, "json", false, "Output merged isomorphisms as a stream of JSON encoded primitives.")
+	flag.BoolVar(&flagLabels, "labels", false, "Require edge labels of SUB to match edge labels of GRAPH.")
 	flag.StringVar(&flagOut, "o", "out.dot", "Output path of the graph.")
+	flag.StringVar(&flagPatterns, "patterns", "", "Directories searched for the patterns SUB before the standard patterns, separated by the OS path list separator.")
 	flag.BoolVar(&flagQuiet, "q", false, "Suppress non-error messages.")
-	flag.StringVar(&flagStart, "start", "", "Merge an isomorphism of SUB in GRAPH which starts at the given node.")
+	flag.StringVar(&flagSet, "set", "", "Pattern-set file listing the patterns SUB and their priorities, one per line.")
+	flag.StringVar(&flagStart, "start", "", "Merge an isomorphism of the highest priority SUB in GRAPH which starts at the given node.")
 	flag.Usage = usage
 }
 
 const use = `
-Usage: merge [OPTION]... SUB.dot GRAPH.dot
-Merges isomorphisms of the subgraph SUB in GRAPH into single nodes.
+Usage: merge [OPTION]... SUB.dot... GRAPH.dot
+       merge [OPTION]... -set SET GRAPH.dot
+Merges isomorphisms of the subgraphs SUB in GRAPH into single nodes.
+
+The subgraphs are given in order of priority, or listed by the pattern-set file
+SET; one pattern per line, optionally followed by its priority (default 0).
+Blank lines and lines starting with '#' are ignored. Isomorphisms of the highest
+priority subgraph are merged first, until no subgraph matches.
 
 Flags:`
 
@@ -60,95 +87,207 @@ func usage() {
 
 func main() {
 	flag.Parse()
-	if flag.NArg() != 2 {
+	if (len(flagSet) > 0 && flag.NArg() != 1) || (len(flagSet) == 0 && flag.NArg() < 2) {
 		flag.Usage()
 		os.Exit(1)
 	}
-	subPath, graphPath := flag.Arg(0), flag.Arg(1)
-	err := locateAndMerge(graphPath, subPath)
+	args := flag.Args()
+	subPaths, graphPath := args[:len(args)-1], args[len(args)-1]
+	err := locateAndMerge(graphPath, subPaths)
 	if err != nil {
 		log.Fatalln(err)
 	}
 }
 
-// locateAndMerge parses the provided graphs and tries to merge isomorphisms of
-// the subgraph in the graph into single nodes.
-func locateAndMerge(graphPath, subPath string) error {
+// locateAndMerge parses the provided graphs and repeatedly merges an
+// isomorphism of the highest priority subgraph in the graph into a single node,
+// until no isomorphism of any subgraph could be located.
+func locateAndMerge(graphPath string, subPaths []string) error {
 	// Parse graph.
 	graph, err := dot.ParseFile(graphPath)
 	if err != nil {
 		return errutil.Err(err)
 	}
 
-	// Search for subgraph in GOPATH if not found.
-	if ok, _ := osutil.Exists(subPath); !ok {
-		dir, err := goutil.SrcDir("decomp.org/x/graphs/testdata/primitives")
+	// Parse subgraphs, in order of priority.
+	lib := patterns.New(filepath.SplitList(flagPatterns)...)
+	var pats []*pattern
+	if len(flagSet) > 0 {
+		pats, err = parseSet(lib, flagSet)
 		if err != nil {
 			return errutil.Err(err)
 		}
-		subPath = filepath.Join(dir, subPath)
-	}
-	sub, err := graphs.ParseSubGraph(subPath)
-	if err != nil {
-		return errutil.Err(err)
-	}
-
-	// Merge isomorphisms.
-	found := false
-	if len(flagStart) > 0 {
-		// Merge an isomorphism of sub in graph which starts at the node
-		// specified by the "-start" flag.
-		m, ok := iso.Isomorphism(graph, flagStart, sub)
-		if ok {
-			found = true
-			printMapping(graph, sub, m)
-			_, err := merge.Merge(graph, m, sub)
+	} else {
+		for i, subPath := range subPaths {
+			sub, err := lookup(lib, "", subPath)
 			if err != nil {
 				return errutil.Err(err)
 			}
+			pats = append(pats, &pattern{sub: sub, priority: len(subPaths) - i})
 		}
-	} else {
-		// Merge all isomorphisms of sub in graph.
-		for {
-			m, ok := iso.Search(graph, sub)
-			if !ok {
-				break
+	}
+	sort.Stable(byPriority(pats))
+
+	// Merge isomorphisms.
+	matcher := iso.Matcher{Labels: flagLabels, Dom: &dom.Cache{}}
+	// Only the entry nodes in the neighbourhood of a merged node are searched
+	// again after each merge. A single isomorphism is merged when the "-start"
+	// flag is set, which requires no incremental search.
+	var incs []*iso.Incremental
+	if len(flagStart) == 0 {
+		for _, pat := range pats {
+			incs = append(incs, matcher.NewIncremental(graph, pat.sub))
+		}
+	}
+	step := 0
+	used := make(map[string]bool)
+	for {
+		var (
+			sub   *graphs.SubGraph
+			match *iso.Match
+			ok    bool
+		)
+		for i, pat := range pats {
+			sub = pat.sub
+			if len(flagStart) > 0 {
+				// Merge an isomorphism of sub in graph which starts at the node
+				// specified by the "-start" flag.
+				match, ok = matcher.Isomorphism(graph, flagStart, sub)
+			} else {
+				match, ok = incs[i].Search()
 			}
-			found = true
-			printMapping(graph, sub, m)
-			_, err := merge.Merge(graph, m, sub)
-			if err != nil {
-				return errutil.Err(err)
+			if ok {
+				break
 			}
 		}
+		if !ok {
+			break
+		}
+		step++
+		// Node names of merged isomorphisms are unique throughout the run, so
+		// that the printed primitives form a hierarchy.
+		name := merge.UniqName(graph, used, sub.Name)
+		if err := merge.MergeAs(graph, match.Nodes, sub, name, matcher.Dom); err != nil {
+			return errutil.Err(err)
+		}
+		for _, inc := range incs {
+			inc.Merged(name)
+		}
+		if err := printMatch(graph, sub, match, name, step); err != nil {
+			return errutil.Err(err)
+		}
+		if len(flagStart) > 0 {
+			// The start node has been merged.
+			break
+		}
 	}
 
 	// Store DOT and PNG representation of graph.
-	if found {
+	if step > 0 {
 		err = dump(graph)
 		if err != nil {
 			return errutil.Err(err)
 		}
-	} else {
+	} else if !flagJSON {
 		fmt.Println("not found.")
 	}
 
 	return nil
 }
 
-// printMapping prints the mapping from sub node name to graph node name for an
-// isomorphism of sub in graph.
-func printMapping(graph *dot.Graph, sub *graphs.SubGraph, m map[string]string) {
+// A pattern is a subgraph with a priority.
+type pattern struct {
+	sub *graphs.SubGraph
+	// Patterns of higher priority are merged first.
+	priority int
+}
+
+// byPriority sorts patterns in descending order of priority.
+type byPriority []*pattern
+
+func (ps byPriority) Len() int           { return len(ps) }
+func (ps byPriority) Less(i, j int) bool { return ps[i].priority > ps[j].priority }
+func (ps byPriority) Swap(i, j int)      { ps[i], ps[j] = ps[j], ps[i] }
+
+// parseSet parses the pattern-set file at the given path, which lists one
+// pattern per line, optionally followed by its priority.
+func parseSet(lib *patterns.Library, setPath string) ([]*pattern, error) {
+	buf, err := ioutil.ReadFile(setPath)
+	if err != nil {
+		return nil, errutil.Err(err)
+	}
+	var pats []*pattern
+	for i, line := range strings.Split(string(buf), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) > 2 {
+			return nil, errutil.Newf("%s:%d: invalid pattern %q; expected pattern optionally followed by priority", setPath, i+1, line)
+		}
+		pat := &pattern{}
+		if len(fields) == 2 {
+			pat.priority, err = strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, errutil.Newf("%s:%d: invalid priority %q", setPath, i+1, fields[1])
+			}
+		}
+		pat.sub, err = lookup(lib, filepath.Dir(setPath), fields[0])
+		if err != nil {
+			return nil, errutil.Newf("%s:%d: %v", setPath, i+1, err)
+		}
+		pats = append(pats, pat)
+	}
+	if len(pats) == 0 {
+		return nil, errutil.Newf("%s: no patterns", setPath)
+	}
+	return pats, nil
+}
+
+// lookup parses the subgraph at subPath, relative to dir, or looks up the
+// subgraph in the pattern library if not found.
+func lookup(lib *patterns.Library, dir, subPath string) (*graphs.SubGraph, error) {
+	path := subPath
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	if ok, _ := osutil.Exists(path); ok {
+		return graphs.ParseSubGraph(path)
+	}
+	return lib.Lookup(strings.TrimSuffix(subPath, ".dot"))
+}
+
+// enc encodes the primitives output by the "-json" flag.
+var enc = json.NewEncoder(os.Stdout)
+
+// printMatch prints the pattern which fired at the given merge step, and the
+// mapping from sub node name to graph node name for its isomorphism in graph,
+// followed by the sub nodes with an inverted branch polarity. If the "-json"
+// flag is set, the isomorphism is instead printed as a JSON encoded primitive,
+// which was merged into the node name.
+func printMatch(graph *dot.Graph, sub *graphs.SubGraph, match *iso.Match, name string, step int) error {
+	m := match.Nodes
+	if flagJSON {
+		prim := &primitive.Primitive{Prim: sub.Name, Node: name, Nodes: m}
+		return enc.Encode(prim)
+	}
 	entry := m[sub.Entry()]
 	var snames []string
 	for sname := range m {
 		snames = append(snames, sname)
 	}
 	sort.Strings(snames)
-	fmt.Printf("Isomorphism of %q found at node %q:\n", sub.Name, entry)
+	fmt.Printf("Step %d: isomorphism of %q found at node %q merged into node %q:\n", step, sub.Name, entry, name)
 	for _, sname := range snames {
 		fmt.Printf("   %q=%q\n", sname, m[sname])
 	}
+	for _, sname := range snames {
+		if match.Inverted[sname] {
+			fmt.Printf("   inverted branch polarity at %q\n", sname)
+		}
+	}
+	return nil
 }
 
 // dump stores the graph as a DOT file and an image representation of the graph
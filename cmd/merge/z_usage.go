@@ -1,11 +1,16 @@
 // Usage:
 //
-//     merge [OPTION]... SUB.dot GRAPH.dot
+//     merge [OPTION]... SUB.dot... GRAPH.dot
+//     merge [OPTION]... -set SET GRAPH.dot
 //
 // Flags:
 //
-//     -img=false:   Generate an image representation of the CFG.
-//     -o="out.dot": Output path of the graph.
-//     -q=false:     Suppress non-error messages.
-//     -start="":    Merge an isomorphism of SUB in GRAPH which starts at the given node.
+//     -img=false:    Generate an image representation of the CFG.
+//     -json=false:   Output merged isomorphisms as a stream of JSON encoded primitives.
+//     -labels=false: Require edge labels of SUB to match edge labels of GRAPH.
+//     -o="out.dot":  Output path of the graph.
+//     -patterns="":  Directories searched for the patterns SUB before the standard patterns, separated by the OS path list separator.
+//     -q=false:      Suppress non-error messages.
+//     -set="":       Pattern-set file listing the patterns SUB and their priorities, one per line.
+//     -start="":     Merge an isomorphism of the highest priority SUB in GRAPH which starts at the given node.
 package main
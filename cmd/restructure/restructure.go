@@ -0,0 +1,235 @@
+//go:generate usagen restructure
+//go:generate mv z_usage.go z_usage.bak
+//go:generate mango -plain restructure.go
+//go:generate mv z_usage.bak z_usage.go
+
+// restructure is a tool which recovers the high-level control flow primitives
+// of graphs.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	"decomp.org/x/graphs"
+	"decomp.org/x/graphs/analysis"
+	"decomp.org/x/graphs/iso"
+	"decomp.org/x/graphs/patterns"
+	"decomp.org/x/graphs/primitive"
+	"decomp.org/x/graphs/restructure"
+	"decomp.org/x/graphs/split"
+	"github.com/mewfork/dot"
+	"github.com/mewkiz/pkg/errutil"
+	"github.com/mewkiz/pkg/pathutil"
+)
+
+var (
+	// When flagImage is true, generate an image representation of the CFG.
+	flagImage bool
+	// When flagLabels is true, require edge labels of the primitives to match
+	// the edge labels of the graph.
+	flagLabels bool
+	// flagOut specifies the output path of the graph.
+	flagOut string
+	// flagPatterns specifies the directories searched for the patterns of the
+	// primitives before the standard patterns, separated by
+	// os.PathListSeparator.
+	flagPatterns string
+	// When flagPST is true, classify the regions of the program structure tree
+	// instead of restructuring the graph.
+	flagPST bool
+	// When flagQuiet is true, suppress non-error messages.
+	flagQuiet bool
+	// When flagSplit is true, split nodes of irreducible graphs before
+	// restructuring.
+	flagSplit bool
+	// When flagTree is true, output the control flow structure tree instead of
+	// the stream of merged primitives.
+	flagTree bool
+)
+
+func init() {
+	flag.BoolVar(&flagImage, "img", false, "Generate an image representation of the CFG.")
+	flag.BoolVar(&flagLabels, "labels", false, "Require edge labels of the primitives to match edge labels of GRAPH.")
+	flag.StringVar(&flagOut, "o", "out.dot", "Output path of the graph.")
+	flag.StringVar(&flagPatterns, "patterns", "", "Directories searched for the primitives before the standard patterns, separated by the OS path list separator.")
+	flag.BoolVar(&flagPST, "pst", false, "Classify the canonical single-entry/single-exit regions of GRAPH instead of restructuring it.")
+	flag.BoolVar(&flagQuiet, "q", false, "Suppress non-error messages.")
+	flag.BoolVar(&flagSplit, "split", false, "Split nodes of irreducible graphs to make them reducible before restructuring.")
+	flag.BoolVar(&flagTree, "tree", false, "Output the control flow structure tree as JSON.")
+	flag.Usage = usage
+}
+
+const use = `
+Usage: restructure [OPTION]... GRAPH.dot
+Recovers the high-level control flow primitives of GRAPH.
+
+Flags:`
+
+func usage() {
+	fmt.Fprintln(os.Stderr, use[1:])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	graphPath := flag.Arg(0)
+	err := restruct(graphPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// restruct parses the provided graph and merges isomorphisms of the control
+// flow primitives into single nodes, until the graph is reduced to a single
+// node or no further primitives could be located. The merged primitives are
+// printed as a stream of JSON encoded primitives, or as a JSON encoded control
+// flow structure tree if the "-tree" flag is set. If the "-pst" flag is set,
+// the regions of the program structure tree are classified instead.
+func restruct(graphPath string) error {
+	// Parse graph.
+	graph, err := dot.ParseFile(graphPath)
+	if err != nil {
+		return errutil.Err(err)
+	}
+
+	// Look up control flow primitives in the pattern library.
+	lib := patterns.New(filepath.SplitList(flagPatterns)...)
+	var subs []*graphs.SubGraph
+	for _, name := range restructure.Prims {
+		sub, err := lib.Lookup(name)
+		if err != nil {
+			return errutil.Err(err)
+		}
+		subs = append(subs, sub)
+	}
+
+	// Split nodes of irreducible graphs.
+	if flagSplit {
+		clones, err := split.Split(graph)
+		if err != nil {
+			return errutil.Err(err)
+		}
+		if !flagQuiet {
+			var names []string
+			for clone := range clones {
+				names = append(names, clone)
+			}
+			sort.Strings(names)
+			for _, clone := range names {
+				log.Printf("Cloned node %q from %q.\n", clone, clones[clone])
+			}
+		}
+	}
+
+	// Restructure graph.
+	matcher := iso.Matcher{Labels: flagLabels}
+	var prims []*primitive.Primitive
+	if flagPST {
+		prims, err = restructure.Classify(graph, subs, matcher)
+	} else {
+		prims, err = restructure.Restructure(graph, subs, matcher)
+	}
+	if err != nil {
+		return errutil.Err(err)
+	}
+	if flagTree {
+		buf, err := json.MarshalIndent(primitive.NewTree(prims), "", "\t")
+		if err != nil {
+			return errutil.Err(err)
+		}
+		fmt.Println(string(buf))
+	} else {
+		enc := json.NewEncoder(os.Stdout)
+		for _, prim := range prims {
+			err = enc.Encode(prim)
+			if err != nil {
+				return errutil.Err(err)
+			}
+		}
+	}
+
+	if flagPST {
+		// Graph is not modified by the classification.
+		return nil
+	}
+
+	// Store DOT and PNG representation of graph.
+	err = dump(graph)
+	if err != nil {
+		return errutil.Err(err)
+	}
+	if n := len(graph.Nodes.Nodes); n != 1 {
+		// Report whether the graph is irreducible or a primitive is missing.
+		loops, err := analysis.MultiEntryLoops(graph)
+		if err != nil {
+			return errutil.Err(err)
+		}
+		if len(loops) == 0 {
+			// Loops with multiple exits (e.g. loops with break statements) are
+			// not restructured, as the loop primitives have a single exit edge.
+			// Report such loops, as they may explain the unreduced graph.
+			forest, err := analysis.NaturalLoops(graph)
+			if err != nil {
+				return errutil.Err(err)
+			}
+			for _, root := range forest {
+				root.Walk(func(l *analysis.Loop, depth int) bool {
+					if len(l.Exits) > 1 {
+						log.Printf("unable to restructure loop with header %q; %d exit edges %v", l.Header, len(l.Exits), l.Exits)
+					}
+					return true
+				})
+			}
+			return errutil.Newf("unable to reduce graph to a single node; %d nodes remain; no matching primitive", n)
+		}
+		for _, loop := range loops {
+			log.Printf("irreducible loop of nodes %q with entry nodes %q", loop.Nodes, loop.Entries)
+		}
+		return errutil.Newf("unable to reduce irreducible graph to a single node; %d nodes remain", n)
+	}
+
+	return nil
+}
+
+// dump stores the graph as a DOT file and an image representation of the graph
+// as a PNG file with filenames based on "-o" flag.
+func dump(graph *dot.Graph) error {
+	// Store graph to DOT file.
+	dotPath := flagOut
+	if !flagQuiet {
+		log.Printf("Creating: %q\n", dotPath)
+	}
+	err := ioutil.WriteFile(dotPath, []byte(graph.String()), 0644)
+	if err != nil {
+		return errutil.Err(err)
+	}
+
+	// Generate an image representation of the graph.
+	if flagImage {
+		pngPath := pathutil.TrimExt(dotPath) + ".png"
+		if !flagQuiet {
+			log.Printf("Creating: %q\n", pngPath)
+		}
+		cmd := exec.Command("dot", "-Tpng", "-o", pngPath, dotPath)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err = cmd.Run()
+		if err != nil {
+			return errutil.Err(err)
+		}
+	}
+
+	return nil
+}
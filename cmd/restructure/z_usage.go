@@ -0,0 +1,15 @@
+// Usage:
+//
+//     restructure [OPTION]... GRAPH.dot
+//
+// Flags:
+//
+//     -img=false:    Generate an image representation of the CFG.
+//     -labels=false: Require edge labels of the primitives to match edge labels of GRAPH.
+//     -o="out.dot":  Output path of the graph.
+//     -patterns="":  Directories searched for the primitives before the standard patterns, separated by the OS path list separator.
+//     -pst=false:    Classify the canonical single-entry/single-exit regions of GRAPH instead of restructuring it.
+//     -q=false:      Suppress non-error messages.
+//     -split=false:  Split nodes of irreducible graphs to make them reducible before restructuring.
+//     -tree=false:   Output the control flow structure tree as JSON.
+package main
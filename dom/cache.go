@@ -0,0 +1,58 @@
+package dom
+
+import (
+	"sync"
+
+	"github.com/mewfork/dot"
+)
+
+// A Cache caches the dominator and post-dominator trees of graphs, so that they
+// are computed once per graph rather than once per use. The cached trees of a
+// graph must be invalidated once the graph is modified; merge.Merge and the
+// other merge functions invalidate the caches they are given. Invalidating the
+// trees of a graph which is no longer searched also releases their memory. The
+// zero value is an empty cache. A Cache is safe for concurrent use.
+type Cache struct {
+	mu    sync.Mutex
+	trees map[*dot.Graph]*Tree
+	posts map[*dot.Graph]*Tree
+}
+
+// Tree returns the dominator tree of graph, which is computed unless cached.
+func (c *Cache) Tree(graph *dot.Graph) *Tree {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if tree, ok := c.trees[graph]; ok {
+		return tree
+	}
+	if c.trees == nil {
+		c.trees = make(map[*dot.Graph]*Tree)
+	}
+	tree := New(graph)
+	c.trees[graph] = tree
+	return tree
+}
+
+// PostTree returns the post-dominator tree of graph, which is computed unless
+// cached.
+func (c *Cache) PostTree(graph *dot.Graph) *Tree {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if tree, ok := c.posts[graph]; ok {
+		return tree
+	}
+	if c.posts == nil {
+		c.posts = make(map[*dot.Graph]*Tree)
+	}
+	tree := NewPost(graph)
+	c.posts[graph] = tree
+	return tree
+}
+
+// Invalidate removes the cached dominator and post-dominator trees of graph.
+func (c *Cache) Invalidate(graph *dot.Graph) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.trees, graph)
+	delete(c.posts, graph)
+}
@@ -0,0 +1,338 @@
+// Package dom implements dominator and post-dominator trees of graphs, using
+// the iterative algorithm of Cooper, Harvey and Kennedy [1].
+//
+// [1]: A Simple, Fast Dominance Algorithm
+//      https://www.cs.rice.edu/~keith/EMBED/dom.pdf
+package dom
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/mewfork/dot"
+)
+
+// A Tree represents the dominator tree, or post-dominator tree, of a graph. A
+// node n dominates a node m if every path from a root of the graph to m passes
+// through n. Post-dominance is dominance in the reverse graph.
+//
+// The roots of a graph are the nodes without predecessors and the node with the
+// "entry" label; for post-dominance the roots are the nodes without successors.
+// If a graph has more than one root, the tree is rooted at a virtual node which
+// immediately dominates every root.
+type Tree struct {
+	// mapping from node ID to node name, in reverse postorder; the virtual root
+	// has the last node ID.
+	names []string
+	// mapping from node name to node ID of nodes reachable from the roots.
+	ids map[string]int
+	// immediate dominator of each node ID; -1 for the root of the tree.
+	idom []int
+	// children of each node ID in the tree.
+	children [][]int
+	// preorder and postorder numbers of each node ID in the tree.
+	pre, post []int
+	// predecessor node IDs of each node ID, in the direction of the tree.
+	preds [][]int
+	// dominance frontier of each node ID; computed on demand.
+	frontier [][]int
+	once     sync.Once
+}
+
+// New returns the dominator tree of graph.
+func New(graph *dot.Graph) *Tree {
+	var roots []*dot.Node
+	for _, node := range graph.Nodes.Nodes {
+		if len(node.Preds) == 0 || node.Attrs["label"] == "entry" {
+			roots = append(roots, node)
+		}
+	}
+	succs := func(node *dot.Node) []*dot.Node { return node.Succs }
+	return newTree(roots, succs)
+}
+
+// NewPost returns the post-dominator tree of graph.
+func NewPost(graph *dot.Graph) *Tree {
+	var roots []*dot.Node
+	for _, node := range graph.Nodes.Nodes {
+		if len(node.Succs) == 0 {
+			roots = append(roots, node)
+		}
+	}
+	preds := func(node *dot.Node) []*dot.Node { return node.Preds }
+	return newTree(roots, preds)
+}
+
+// newTree returns the dominator tree of the graph with the given roots, where
+// succs returns the successors of a node in the direction of the tree.
+func newTree(roots []*dot.Node, succs func(node *dot.Node) []*dot.Node) *Tree {
+	// Sort roots and successors by node name, which makes the algorithm
+	// deterministic.
+	sorted := func(nodes []*dot.Node) []*dot.Node {
+		ns := append([]*dot.Node(nil), nodes...)
+		sort.Sort(byName(ns))
+		return ns
+	}
+
+	// Number the nodes reachable from the roots in postorder.
+	var order []*dot.Node
+	visited := make(map[*dot.Node]bool)
+	var visit func(node *dot.Node)
+	visit = func(node *dot.Node) {
+		visited[node] = true
+		for _, succ := range sorted(succs(node)) {
+			if !visited[succ] {
+				visit(succ)
+			}
+		}
+		order = append(order, node)
+	}
+	roots = sorted(roots)
+	for _, root := range roots {
+		if !visited[root] {
+			visit(root)
+		}
+	}
+
+	// Assign node IDs in reverse postorder, followed by the virtual root.
+	n := len(order)
+	t := &Tree{
+		names: make([]string, n+1),
+		ids:   make(map[string]int, n),
+		idom:  make([]int, n+1),
+		preds: make([][]int, n+1),
+	}
+	for i, node := range order {
+		id := n - 1 - i
+		t.names[id] = node.Name
+		t.ids[node.Name] = id
+	}
+	virtual := n
+	for i := n - 1; i >= 0; i-- {
+		node := order[i]
+		for _, succ := range sorted(succs(node)) {
+			sid := t.ids[succ.Name]
+			t.preds[sid] = append(t.preds[sid], t.ids[node.Name])
+		}
+	}
+	for _, root := range roots {
+		id := t.ids[root.Name]
+		t.preds[id] = append(t.preds[id], virtual)
+	}
+
+	// Compute immediate dominators. Node IDs are assigned in reverse postorder,
+	// so a node ID is smaller than the node IDs of the nodes it dominates; the
+	// virtual root is treated as the smallest node ID.
+	const undef = -2
+	for id := range t.idom {
+		t.idom[id] = undef
+	}
+	t.idom[virtual] = virtual
+	rank := func(id int) int {
+		if id == virtual {
+			return -1
+		}
+		return id
+	}
+	intersect := func(a, b int) int {
+		for a != b {
+			for rank(a) > rank(b) {
+				a = t.idom[a]
+			}
+			for rank(b) > rank(a) {
+				b = t.idom[b]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		for id := 0; id < n; id++ {
+			idom := undef
+			for _, pred := range t.preds[id] {
+				if t.idom[pred] == undef {
+					continue
+				}
+				if idom == undef {
+					idom = pred
+				} else {
+					idom = intersect(pred, idom)
+				}
+			}
+			if t.idom[id] != idom {
+				t.idom[id] = idom
+				changed = true
+			}
+		}
+	}
+	t.idom[virtual] = -1
+
+	// Remove the virtual root if the graph has a single root.
+	if len(roots) == 1 {
+		root := t.ids[roots[0].Name]
+		t.idom[root] = -1
+		t.names = t.names[:n]
+		t.idom = t.idom[:n]
+		t.preds = t.preds[:n]
+		t.preds[root] = without(t.preds[root], virtual)
+	}
+
+	// Number the nodes of the tree in preorder and postorder.
+	t.children = make([][]int, len(t.idom))
+	var treeRoot int
+	for id, idom := range t.idom {
+		if idom == -1 {
+			treeRoot = id
+			continue
+		}
+		t.children[idom] = append(t.children[idom], id)
+	}
+	t.pre = make([]int, len(t.idom))
+	t.post = make([]int, len(t.idom))
+	var pre, post int
+	var number func(id int)
+	number = func(id int) {
+		t.pre[id] = pre
+		pre++
+		for _, child := range t.children[id] {
+			number(child)
+		}
+		t.post[id] = post
+		post++
+	}
+	if len(t.idom) > 0 {
+		number(treeRoot)
+	}
+	return t
+}
+
+// Root returns the node name of the root of the tree. The boolean value is
+// false if the tree is rooted at a virtual node, or if the tree is empty.
+func (t *Tree) Root() (name string, ok bool) {
+	for id, idom := range t.idom {
+		if idom == -1 {
+			if id >= len(t.ids) {
+				return "", false
+			}
+			return t.names[id], true
+		}
+	}
+	return "", false
+}
+
+// Idom returns the node name of the immediate dominator of the given node. The
+// boolean value is false if the node has no immediate dominator; i.e. if the
+// node is a root of the graph, or unreachable from the roots of the graph.
+func (t *Tree) Idom(name string) (idom string, ok bool) {
+	id, ok := t.ids[name]
+	if !ok {
+		return "", false
+	}
+	i := t.idom[id]
+	if i == -1 || i >= len(t.ids) {
+		// Root of the tree or child of the virtual root.
+		return "", false
+	}
+	return t.names[i], true
+}
+
+// Children returns the sorted node names of the nodes immediately dominated by
+// the given node.
+func (t *Tree) Children(name string) []string {
+	id, ok := t.ids[name]
+	if !ok {
+		return nil
+	}
+	names := t.nodeNames(t.children[id])
+	sort.Strings(names)
+	return names
+}
+
+// Dominates reports whether the node n dominates the node m. Every node
+// dominates itself. Nodes unreachable from the roots of the graph only dominate
+// themselves.
+func (t *Tree) Dominates(n, m string) bool {
+	if n == m {
+		return true
+	}
+	a, ok := t.ids[n]
+	if !ok {
+		return false
+	}
+	b, ok := t.ids[m]
+	if !ok {
+		return false
+	}
+	return t.pre[a] <= t.pre[b] && t.post[b] <= t.post[a]
+}
+
+// Frontier returns the sorted node names of the dominance frontier of the
+// given node; i.e. the nodes m such that the node dominates a predecessor of m
+// but does not strictly dominate m. The post-dominance frontier of a node is
+// the set of nodes it is control dependent on.
+func (t *Tree) Frontier(name string) []string {
+	id, ok := t.ids[name]
+	if !ok {
+		return nil
+	}
+	t.once.Do(t.frontiers)
+	names := t.nodeNames(t.frontier[id])
+	sort.Strings(names)
+	return names
+}
+
+// frontiers computes the dominance frontier of every node.
+func (t *Tree) frontiers() {
+	t.frontier = make([][]int, len(t.idom))
+	seen := make([]map[int]bool, len(t.idom))
+	for id := range seen {
+		seen[id] = make(map[int]bool)
+	}
+	for id, preds := range t.preds {
+		if len(preds) < 2 {
+			continue
+		}
+		for _, pred := range preds {
+			for runner := pred; runner != -1 && runner != t.idom[id]; runner = t.idom[runner] {
+				if runner >= len(t.idom) {
+					// Virtual root, which is not part of the tree.
+					break
+				}
+				if !seen[runner][id] {
+					seen[runner][id] = true
+					t.frontier[runner] = append(t.frontier[runner], id)
+				}
+			}
+		}
+	}
+}
+
+// nodeNames returns the node names of the given node IDs, omitting the
+// virtual root.
+func (t *Tree) nodeNames(ids []int) []string {
+	var names []string
+	for _, id := range ids {
+		if id < len(t.ids) {
+			names = append(names, t.names[id])
+		}
+	}
+	return names
+}
+
+// without returns the node IDs of ids except x.
+func without(ids []int, x int) []int {
+	var out []int
+	for _, id := range ids {
+		if id != x {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// byName implements sort.Interface, sorting nodes by name.
+type byName []*dot.Node
+
+func (ns byName) Len() int           { return len(ns) }
+func (ns byName) Less(i, j int) bool { return ns[i].Name < ns[j].Name }
+func (ns byName) Swap(i, j int)      { ns[i], ns[j] = ns[j], ns[i] }
@@ -0,0 +1,139 @@
+package dom
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mewfork/dot"
+)
+
+func TestDominates(t *testing.T) {
+	graphPaths := []string{
+		"../testdata/c4_graphs/expr.dot",
+		"../testdata/c4_graphs/main.dot",
+		"../testdata/c4_graphs/next.dot",
+		"../testdata/c4_graphs/stmt.dot",
+		"../testdata/infinity_graphs/main.dot",
+	}
+	for _, graphPath := range graphPaths {
+		graph, err := dot.ParseFile(graphPath)
+		if err != nil {
+			t.Errorf("%s: %v", graphPath, err)
+			continue
+		}
+		tree := New(graph)
+		for _, n := range graph.Nodes.Nodes {
+			for _, m := range graph.Nodes.Nodes {
+				want := n.Dominates(m)
+				if got := tree.Dominates(n.Name, m.Name); got != want {
+					t.Errorf("%s: dominance mismatch of %q and %q; expected %v, got %v", graphPath, n.Name, m.Name, want, got)
+				}
+			}
+		}
+	}
+}
+
+// src is the control flow graph of
+//
+//    0: if (x) {
+//    1:    y
+//       } else {
+//    2:    do {
+//    3:       z
+//          } while (w)
+//       }
+//    4: return
+const src = `digraph f {
+	0->1
+	0->2
+	1->4
+	2->3
+	3->3
+	3->4
+	0 [label="entry"]
+	1
+	2
+	3
+	4
+}`
+
+func TestTree(t *testing.T) {
+	graph, err := dot.Read([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := []struct {
+		name string
+		// Immediate dominator; empty for the root.
+		idom string
+		// Children in the dominator tree.
+		children []string
+		// Dominance frontier.
+		frontier []string
+		// Immediate post-dominator; empty for the root.
+		ipdom string
+		// Post-dominance frontier.
+		pfrontier []string
+	}{
+		{name: "0", idom: "", children: []string{"1", "2", "4"}, frontier: nil, ipdom: "4", pfrontier: nil},
+		{name: "1", idom: "0", children: nil, frontier: []string{"4"}, ipdom: "4", pfrontier: []string{"0"}},
+		{name: "2", idom: "0", children: []string{"3"}, frontier: []string{"4"}, ipdom: "3", pfrontier: []string{"0"}},
+		{name: "3", idom: "2", children: nil, frontier: []string{"3", "4"}, ipdom: "4", pfrontier: []string{"0", "3"}},
+		{name: "4", idom: "0", children: nil, frontier: nil, ipdom: "", pfrontier: nil},
+	}
+
+	tree := New(graph)
+	post := NewPost(graph)
+	if root, ok := tree.Root(); !ok || root != "0" {
+		t.Errorf("root mismatch; expected %q, got %q", "0", root)
+	}
+	if root, ok := post.Root(); !ok || root != "4" {
+		t.Errorf("post-dominator root mismatch; expected %q, got %q", "4", root)
+	}
+	for _, g := range golden {
+		idom, _ := tree.Idom(g.name)
+		if idom != g.idom {
+			t.Errorf("%q: immediate dominator mismatch; expected %q, got %q", g.name, g.idom, idom)
+		}
+		if children := tree.Children(g.name); !reflect.DeepEqual(children, g.children) {
+			t.Errorf("%q: children mismatch; expected %q, got %q", g.name, g.children, children)
+		}
+		if frontier := tree.Frontier(g.name); !reflect.DeepEqual(frontier, g.frontier) {
+			t.Errorf("%q: dominance frontier mismatch; expected %q, got %q", g.name, g.frontier, frontier)
+		}
+		ipdom, _ := post.Idom(g.name)
+		if ipdom != g.ipdom {
+			t.Errorf("%q: immediate post-dominator mismatch; expected %q, got %q", g.name, g.ipdom, ipdom)
+		}
+		if frontier := post.Frontier(g.name); !reflect.DeepEqual(frontier, g.pfrontier) {
+			t.Errorf("%q: post-dominance frontier mismatch; expected %q, got %q", g.name, g.pfrontier, frontier)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	graph, err := dot.Read([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Cache{}
+	tree, post := c.Tree(graph), c.PostTree(graph)
+	if c.Tree(graph) != tree || c.PostTree(graph) != post {
+		t.Errorf("cached trees of unmodified graph recomputed")
+	}
+	if idom, _ := tree.Idom("3"); idom != "2" {
+		t.Errorf("immediate dominator mismatch; expected %q, got %q", "2", idom)
+	}
+	graph.AddEdge("0", "", "3", "", true, nil)
+	graph.AddEdge("1", "", "5", "", true, nil)
+	if c.Tree(graph) != tree || c.PostTree(graph) != post {
+		t.Errorf("cached trees of modified graph recomputed before invalidation")
+	}
+	c.Invalidate(graph)
+	if idom, _ := c.Tree(graph).Idom("3"); idom != "0" {
+		t.Errorf("immediate dominator mismatch of modified graph; expected %q, got %q", "0", idom)
+	}
+	if ipdom, _ := c.PostTree(graph).Idom("1"); ipdom != "" {
+		t.Errorf("immediate post-dominator mismatch of modified graph; expected %q, got %q", "", ipdom)
+	}
+}
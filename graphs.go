@@ -2,6 +2,11 @@
 package graphs
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/mewfork/dot"
 	"github.com/mewkiz/pkg/errutil"
 )
@@ -9,22 +14,49 @@ import (
 // SubGraph represents a subgraph with a dedicated entry and exit node. Incoming
 // edges to entry and outgoing edges from exit are ignored when searching for
 // isomorphisms of the subgraph.
+//
+// Subgraphs of primitives which never terminate (e.g. an infinite loop) have no
+// exit node, in which case the outgoing edges of every node are considered.
+//
+// A node with the "repeat" attribute set to "+" is a repeat node, which matches
+// a chain of one or more graph nodes; i.e. a straight-line sequence of nodes in
+// which each node except the last has a single successor, and each node except
+// the first has a single predecessor. The incoming edges of a repeat node are
+// matched by the first node of the chain and the outgoing edges by the last,
+// e.g.
+//
+//    digraph seq {
+//       A [role="entry", repeat="+"]
+//       B [role="exit"]
+//       A->B
+//    }
+//
+// The exit node may not be a repeat node, as its outgoing edges are ignored.
+//
+// The attributes of the graph nodes matched by a sub node may be constrained
+// by predicates; see Predicate.
 type SubGraph struct {
 	*dot.Graph
 	entry, exit string
+	// sorted node names of the repeat nodes.
+	repeats []string
+	// predicates of each sub node; sub nodes without predicates are omitted.
+	preds map[string][]*Predicate
+	// role of each sub node; sub nodes with the "any" role are omitted.
+	roles map[string]Role
 }
 
 // ParseSubGraph parses the provided DOT file into a subgraph with a dedicated
 // entry and exit node. The entry and exit nodes are identified using the node
-// "label" attribute, e.g.
+// "role" attribute, e.g.
 //
 //    digraph if {
 //       A->B [label="true"]
 //       A->C [label="false"]
 //       B->C
-//       A [label="entry"]
+//       A [role="entry"]
 //       B
-//       C [label="exit"]
+//       C [role="exit"]
 //    }
 func ParseSubGraph(path string) (*SubGraph, error) {
 	graph, err := dot.ParseFile(path)
@@ -35,47 +67,92 @@ func ParseSubGraph(path string) (*SubGraph, error) {
 }
 
 // NewSubGraph returns a new subgraph based on graph with a dedicated entry and
-// exit node. The entry and exit nodes are identified using the node "label"
+// exit node. The entry and exit nodes are identified using the node "role"
 // attribute, e.g.
 //
 //    digraph if {
 //       A->B [label="true"]
 //       A->C [label="false"]
 //       B->C
-//       A [label="entry"]
+//       A [role="entry"]
 //       B
-//       C [label="exit"]
+//       C [role="exit"]
 //    }
+//
+// The exit node is optional; subgraphs without a node with the "exit" role
+// have no exit node. Nodes without a "role" attribute fall back to the "label"
+// attribute if it specifies a role; see Role.
 func NewSubGraph(graph *dot.Graph) (*SubGraph, error) {
-	sub := &SubGraph{Graph: graph}
+	sub := &SubGraph{Graph: graph, roles: make(map[string]Role)}
 
 	// Locate entry and exit nodes.
 	var hasEntry, hasExit bool
 	for _, node := range graph.Nodes.Nodes {
-		label, ok := node.Attrs["label"]
-		if !ok {
-			continue
+		role, err := parseRole(node)
+		if err != nil {
+			return nil, errutil.Err(err)
 		}
-		switch label {
-		case "entry":
+		switch role {
+		case RoleEntry:
 			if hasEntry {
-				return nil, errutil.Newf(`redefinition of node with "entry" label; previous node %q, new node %q`, sub.entry, node.Name)
+				return nil, errutil.Newf(`redefinition of node with "entry" role; previous node %q, new node %q`, sub.entry, node.Name)
 			}
 			sub.entry = node.Name
 			hasEntry = true
-		case "exit":
+		case RoleExit:
 			if hasExit {
-				return nil, errutil.Newf(`redefinition of node with "exit" label; previous node %q, new node %q`, sub.exit, node.Name)
+				return nil, errutil.Newf(`redefinition of node with "exit" role; previous node %q, new node %q`, sub.exit, node.Name)
 			}
 			sub.exit = node.Name
 			hasExit = true
+		case RoleReturn:
+			if n := len(node.Succs); n > 0 {
+				return nil, errutil.Newf(`invalid node %q with "return" role; expected 0 successors, got %d`, node.Name, n)
+			}
+		}
+		if role != RoleAny {
+			sub.roles[node.Name] = role
 		}
 	}
 	if !hasEntry {
-		return nil, errutil.New(`unable to locate node with "entry" label`)
+		return nil, errutil.New(`unable to locate node with "entry" role`)
+	}
+
+	// Parse node attribute predicates.
+	for _, node := range graph.Nodes.Nodes {
+		preds, err := parsePredicates(node.Name, node.Attrs)
+		if err != nil {
+			return nil, errutil.Err(err)
+		}
+		if len(preds) > 0 {
+			if sub.preds == nil {
+				sub.preds = make(map[string][]*Predicate)
+			}
+			sub.preds[node.Name] = preds
+		}
+	}
+
+	// Locate repeat nodes.
+	for _, node := range graph.Nodes.Nodes {
+		repeat, ok := node.Attrs["repeat"]
+		if !ok {
+			continue
+		}
+		if repeat != "+" {
+			return nil, errutil.Newf(`invalid "repeat" attribute %q of node %q; expected "+"`, repeat, node.Name)
+		}
+		if node.Name == sub.exit {
+			return nil, errutil.Newf(`invalid "repeat" attribute of exit node %q`, node.Name)
+		}
+		sub.repeats = append(sub.repeats, node.Name)
 	}
-	if !hasExit {
-		return nil, errutil.New(`unable to locate node with "exit" label`)
+	sort.Strings(sub.repeats)
+	for _, name := range sub.repeats {
+		for _, node := range graph.Nodes.Nodes {
+			if isChainName(node.Name, name) {
+				return nil, errutil.Newf("node name %q collides with chain of repeat node %q", node.Name, name)
+			}
+		}
 	}
 
 	return sub, nil
@@ -86,7 +163,81 @@ func (sub *SubGraph) Entry() string {
 	return sub.entry
 }
 
-// Exit returns the exit node name in the subgraph.
+// Exit returns the exit node name in the subgraph, or an empty string if the
+// subgraph has no exit node.
 func (sub *SubGraph) Exit() string {
 	return sub.exit
 }
+
+// Repeats returns the sorted node names of the repeat nodes in the subgraph.
+func (sub *SubGraph) Repeats() []string {
+	return sub.repeats
+}
+
+// Expand returns a copy of the subgraph in which each repeat node is replaced
+// by a chain of nodes, the length of which is specified by lengths. The first
+// node of the chain of a repeat node keeps its name, and the following nodes
+// are named by ChainName, and share the predicates of the repeat node. Repeat
+// nodes without a specified length are replaced by a chain of a single node.
+func (sub *SubGraph) Expand(lengths map[string]int) (*SubGraph, error) {
+	// last returns the name of the last node in the chain of the given node.
+	last := func(name string) string {
+		if n := lengths[name]; n > 1 {
+			return ChainName(name, n-1)
+		}
+		return name
+	}
+	graph := dot.NewGraph()
+	graph.SetName(sub.Name)
+	for _, node := range sub.Nodes.Nodes {
+		attrs := make(map[string]string)
+		for key, val := range node.Attrs {
+			if key != "repeat" {
+				attrs[key] = val
+			}
+		}
+		graph.AddNode(sub.Name, node.Name, attrs)
+		preds := make(map[string]string)
+		for key, val := range attrs {
+			if isPredicate(key) {
+				preds[key] = val
+			}
+		}
+		for i := 1; i < lengths[node.Name]; i++ {
+			graph.AddNode(sub.Name, ChainName(node.Name, i), preds)
+			graph.AddEdge(ChainName(node.Name, i-1), "", ChainName(node.Name, i), "", true, nil)
+		}
+	}
+	for _, node := range sub.Nodes.Nodes {
+		for _, succ := range node.Succs {
+			attrs := make(map[string]string)
+			if e, ok := sub.Edges.SrcToDsts[node.Name][succ.Name]; ok {
+				for key, val := range e.Attrs {
+					attrs[key] = val
+				}
+			}
+			graph.AddEdge(last(node.Name), "", succ.Name, "", true, attrs)
+		}
+	}
+	return NewSubGraph(graph)
+}
+
+// ChainName returns the sub node name of the i:th node, counting from zero, in
+// the chain of the given repeat node; e.g. "A.2" for the third node of "A". The
+// first node of the chain keeps the name of the repeat node.
+func ChainName(name string, i int) string {
+	if i == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s.%d", name, i)
+}
+
+// isChainName reports whether s is the name of a node following the first node
+// in the chain of the given repeat node.
+func isChainName(s, name string) bool {
+	if !strings.HasPrefix(s, name+".") {
+		return false
+	}
+	i, err := strconv.Atoi(s[len(name)+1:])
+	return err == nil && i > 0
+}
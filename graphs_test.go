@@ -0,0 +1,295 @@
+package graphs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mewfork/dot"
+)
+
+func TestNewSubGraphRepeat(t *testing.T) {
+	golden := []struct {
+		src     string
+		repeats []string
+		err     string
+	}{
+		// i=0
+		{
+			src:     `digraph list { A [label="entry", repeat="+"]; B [label="exit"]; A->B }`,
+			repeats: []string{"A"},
+		},
+		// i=1
+		{
+			src: `digraph list { A [label="entry"]; B [label="exit", repeat="+"]; A->B }`,
+			err: `invalid "repeat" attribute of exit node "B"`,
+		},
+		// i=2
+		{
+			src: `digraph list { A [label="entry", repeat="*"]; B [label="exit"]; A->B }`,
+			err: `invalid "repeat" attribute "*" of node "A"; expected "+"`,
+		},
+		// i=3
+		{
+			src: `digraph list { A [label="entry", repeat="+"]; "A.1"; B [label="exit"]; A->"A.1"; "A.1"->B }`,
+			err: `node name "A.1" collides with chain of repeat node "A"`,
+		},
+	}
+
+	for i, g := range golden {
+		graph, err := dot.Read([]byte(g.src))
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		sub, err := NewSubGraph(graph)
+		if len(g.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), g.err) {
+				t.Errorf("i=%d: error mismatch; expected %q, got %v", i, g.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(sub.Repeats(), g.repeats) {
+			t.Errorf("i=%d: repeat nodes mismatch; expected %v, got %v", i, g.repeats, sub.Repeats())
+		}
+	}
+}
+
+func TestSubGraphExpand(t *testing.T) {
+	graph, err := dot.Read([]byte(`digraph if { A [label="entry"]; B [repeat="+"]; C [label="exit"]; A->B [label="true"]; A->C [label="false"]; B->C }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := NewSubGraph(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expanded, err := sub.Expand(map[string]int{"B": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"A":   {"B", "C"},
+		"B":   {"B.1"},
+		"B.1": {"B.2"},
+		"B.2": {"C"},
+		"C":   nil,
+	}
+	got := make(map[string][]string)
+	for _, node := range expanded.Nodes.Nodes {
+		got[node.Name] = nil
+		for _, succ := range node.Succs {
+			got[node.Name] = append(got[node.Name], succ.Name)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("successors mismatch; expected %v, got %v", want, got)
+	}
+	if len(expanded.Repeats()) != 0 {
+		t.Errorf("repeat nodes mismatch; expected none, got %v", expanded.Repeats())
+	}
+	if label := expanded.Edges.SrcToDsts["A"]["B"].Attrs["label"]; label != "true" {
+		t.Errorf("edge label mismatch; expected %q, got %q", "true", label)
+	}
+}
+
+func TestNewSubGraphPredicates(t *testing.T) {
+	golden := []struct {
+		src string
+		// Predicates of node "A".
+		want []string
+		err  string
+	}{
+		// i=0
+		{
+			src:  `digraph list { A [label="entry", re_inst="ret$", eq_kind="call", has_dbg="false"]; B [label="exit"]; A->B }`,
+			want: []string{`has_dbg="false"`, `re_inst="ret$"`, `eq_kind="call"`},
+		},
+		// i=1
+		{
+			src: `digraph list { A [label="entry", re_inst="(ret"]; B [label="exit"]; A->B }`,
+			err: `invalid "re_inst" attribute of node "A"`,
+		},
+		// i=2
+		{
+			src: `digraph list { A [label="entry", has_kind="yes"]; B [label="exit"]; A->B }`,
+			err: `invalid "has_kind" attribute "yes" of node "A"; expected "true" or "false"`,
+		},
+	}
+
+	for i, g := range golden {
+		graph, err := dot.Read([]byte(g.src))
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		sub, err := NewSubGraph(graph)
+		if len(g.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), g.err) {
+				t.Errorf("i=%d: error mismatch; expected %q, got %v", i, g.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		var got []string
+		for _, p := range sub.Predicates("A") {
+			got = append(got, p.String())
+		}
+		if !reflect.DeepEqual(got, g.want) {
+			t.Errorf("i=%d: predicates mismatch; expected %v, got %v", i, g.want, got)
+		}
+	}
+}
+
+func TestNewSubGraphRole(t *testing.T) {
+	golden := []struct {
+		src         string
+		entry, exit string
+		// Role of node "B".
+		role Role
+		err  string
+	}{
+		// i=0
+		{
+			src:   `digraph if_return { A [role="entry"]; B [role="return"]; C [role="exit"]; A->B; A->C }`,
+			entry: "A", exit: "C", role: RoleReturn,
+		},
+		// i=1
+		{
+			src:   `digraph if_return { A [label="entry"]; B [label="return"]; C [label="exit"]; A->B; A->C }`,
+			entry: "A", exit: "C", role: RoleReturn,
+		},
+		// i=2
+		{
+			src:   `digraph list { A [role="entry", label="exit"]; B [role="any", label="entry"]; A->B }`,
+			entry: "A", role: RoleAny,
+		},
+		// i=3
+		{
+			src:   `digraph list { A [role="entry"]; B [label="B: ret"]; A->B }`,
+			entry: "A", role: RoleAny,
+		},
+		// i=4
+		{
+			src: `digraph list { A [role="entry"]; B [role="start"]; A->B }`,
+			err: `invalid "role" attribute "start" of node "B"; expected "entry", "exit", "return" or "any"`,
+		},
+		// i=5
+		{
+			src: `digraph list { A [role="entry"]; B [role="return"]; C [role="exit"]; A->B; B->C }`,
+			err: `invalid node "B" with "return" role; expected 0 successors, got 1`,
+		},
+		// i=6
+		{
+			src: `digraph list { A [role="entry"]; B [label="entry"]; A->B }`,
+			err: `redefinition of node with "entry" role; previous node "A", new node "B"`,
+		},
+		// i=7
+		{
+			src: `digraph list { A; B [role="exit"]; A->B }`,
+			err: `unable to locate node with "entry" role`,
+		},
+	}
+
+	for i, g := range golden {
+		graph, err := dot.Read([]byte(g.src))
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		sub, err := NewSubGraph(graph)
+		if len(g.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), g.err) {
+				t.Errorf("i=%d: error mismatch; expected %q, got %v", i, g.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		if sub.Entry() != g.entry {
+			t.Errorf("i=%d: entry node mismatch; expected %q, got %q", i, g.entry, sub.Entry())
+		}
+		if sub.Exit() != g.exit {
+			t.Errorf("i=%d: exit node mismatch; expected %q, got %q", i, g.exit, sub.Exit())
+		}
+		if role := sub.Role("B"); role != g.role {
+			t.Errorf("i=%d: role mismatch; expected %q, got %q", i, g.role, role)
+		}
+	}
+}
+
+func TestNewSubGraphNoExit(t *testing.T) {
+	golden := []struct {
+		path string
+		src  string
+		// Successors of each node.
+		succs map[string][]string
+	}{
+		// i=0
+		{
+			path:  "testdata/primitives/inf_loop.dot",
+			succs: map[string][]string{"A": {"A"}},
+		},
+		// i=1
+		{
+			src:   `digraph inf_loop { A [role="entry"]; B; A->B; B->A }`,
+			succs: map[string][]string{"A": {"B"}, "B": {"A"}},
+		},
+	}
+
+	for i, g := range golden {
+		var sub *SubGraph
+		var err error
+		if len(g.path) > 0 {
+			sub, err = ParseSubGraph(g.path)
+		} else {
+			var graph *dot.Graph
+			graph, err = dot.Read([]byte(g.src))
+			if err == nil {
+				sub, err = NewSubGraph(graph)
+			}
+		}
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		// The String output of a subgraph without an exit node parses into the
+		// same subgraph.
+		graph, err := dot.Read([]byte(sub.String()))
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		parsed, err := NewSubGraph(graph)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		for j, s := range []*SubGraph{sub, parsed} {
+			if s.Entry() != "A" {
+				t.Errorf("i=%d j=%d: entry node mismatch; expected %q, got %q", i, j, "A", s.Entry())
+			}
+			if s.Exit() != "" {
+				t.Errorf("i=%d j=%d: exit node mismatch; expected none, got %q", i, j, s.Exit())
+			}
+			got := make(map[string][]string)
+			for _, node := range s.Nodes.Nodes {
+				for _, succ := range node.Succs {
+					got[node.Name] = append(got[node.Name], succ.Name)
+				}
+			}
+			if !reflect.DeepEqual(got, g.succs) {
+				t.Errorf("i=%d j=%d: successors mismatch; expected %v, got %v", i, j, g.succs, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package iso
+
+import (
+	"sort"
+	"strings"
+
+	"decomp.org/x/graphs"
+)
+
+// Automorphisms returns the automorphism group of sub as a list of mappings
+// from sub node name to sub node name. An automorphism preserves every edge of
+// sub, the node roles (e.g. "entry", "exit", "return") and the node attribute
+// predicates. The identity mapping is always the first element of the group.
+//
+// Two isomorphisms m1 and m2 of sub in a graph are equivalent if there exists
+// an automorphism a of sub such that m2[s] == m1[a[s]] for every sub node s.
+func Automorphisms(sub *graphs.SubGraph) []map[string]string {
+	return automorphisms(sub, false)
+}
+
+// automorphisms returns the automorphism group of sub. When labels is true,
+// the automorphisms are also required to preserve edge labels, up to an
+// inversion of the branch polarity of each node; i.e. the "true" and "false"
+// labels of the outgoing edges of a node may be swapped, as when matching
+// edge labels (e.g. swapping the branches of an if-else primitive).
+func automorphisms(sub *graphs.SubGraph, labels bool) []map[string]string {
+	si := newSubIndex(sub)
+	a := &automorphism{
+		sub:    sub,
+		si:     si,
+		labels: labels,
+		m:      make([]int, si.len()),
+		used:   newBitset(si.len()),
+	}
+	a.solve(0)
+	return a.auts
+}
+
+// automorphism tracks the state of the automorphism search.
+type automorphism struct {
+	// Subgraph.
+	sub *graphs.SubGraph
+	// Compact representation of sub.
+	si *subIndex
+	// Require automorphisms to preserve edge labels, up to an inversion of the
+	// branch polarity of each node.
+	labels bool
+	// Partial mapping from sub node ID to sub node ID.
+	m []int
+	// Set of sub node IDs used as values in m.
+	used bitset
+	// Automorphisms located.
+	auts []map[string]string
+}
+
+// solve recursively extends the partial mapping with the sub node of ID i, and
+// records each complete mapping as an automorphism. Sub node IDs are assigned
+// in sorted node name order, which makes the algorithm deterministic.
+func (a *automorphism) solve(i int) {
+	if i == a.si.len() {
+		if a.labels && !a.samePolarity() {
+			return
+		}
+		aut := make(map[string]string, len(a.m))
+		for from, to := range a.m {
+			aut[a.si.names[from]] = a.si.names[to]
+		}
+		a.auts = append(a.auts, aut)
+		return
+	}
+	// Try the identity first to make it the first automorphism located.
+	targets := make([]int, 0, a.si.len())
+	targets = append(targets, i)
+	for to := 0; to < a.si.len(); to++ {
+		if to != i {
+			targets = append(targets, to)
+		}
+	}
+	for _, to := range targets {
+		if a.used.has(to) || !a.isConsistent(i, to) {
+			continue
+		}
+		a.m[i] = to
+		a.used.set(to)
+		a.solve(i + 1)
+		a.used.clear(to)
+	}
+}
+
+// isConsistent returns true if mapping the sub node from to the sub node to
+// preserves the node roles, the node attribute predicates, the degrees and the
+// edges to and from every sub node already mapped, and false otherwise.
+func (a *automorphism) isConsistent(from, to int) bool {
+	f := a.sub.Nodes.Lookup[a.si.names[from]]
+	t := a.sub.Nodes.Lookup[a.si.names[to]]
+	if a.sub.Role(f.Name) != a.sub.Role(t.Name) {
+		return false
+	}
+	if !samePredicates(a.sub.Predicates(f.Name), a.sub.Predicates(t.Name)) {
+		return false
+	}
+	si := a.si
+	if len(si.preds[from]) != len(si.preds[to]) || len(si.succs[from]) != len(si.succs[to]) {
+		return false
+	}
+	if !a.sameEdge(from, from, to, to) {
+		return false
+	}
+	// Sub nodes with an ID below from are already mapped.
+	for u := 0; u < from; u++ {
+		v := a.m[u]
+		if !a.sameEdge(from, u, to, v) || !a.sameEdge(u, from, v, to) {
+			return false
+		}
+	}
+	return true
+}
+
+// samePredicates returns true if the sorted node attribute predicates ps and qs
+// are equal, and false otherwise.
+func samePredicates(ps, qs []*graphs.Predicate) bool {
+	if len(ps) != len(qs) {
+		return false
+	}
+	for i := range ps {
+		if ps[i].String() != qs[i].String() {
+			return false
+		}
+	}
+	return true
+}
+
+// sameEdge returns true if the edge from src1 to dst1 and the edge from src2
+// to dst2 are either both present or both absent in sub, and false otherwise.
+func (a *automorphism) sameEdge(src1, dst1, src2, dst2 int) bool {
+	return a.si.hasEdge(src1, dst1) == a.si.hasEdge(src2, dst2)
+}
+
+// samePolarity returns true if the complete mapping preserves the labels of
+// the outgoing edges of every sub node, either directly or inverted, and false
+// otherwise.
+func (a *automorphism) samePolarity() bool {
+	si := a.si
+	for from := 0; from < si.len(); from++ {
+		exact, inverted := true, true
+		for _, succ := range si.succs[from] {
+			label := si.label(a.m[from], a.m[succ])
+			if si.label(from, succ) != label {
+				exact = false
+			}
+			if si.label(from, succ) != invertLabel(label) {
+				inverted = false
+			}
+		}
+		if !exact && !inverted {
+			return false
+		}
+	}
+	return true
+}
+
+// canonical returns the canonical mapping of the equivalence class of m under
+// the automorphisms auts; i.e. the mapping m∘a of lowest rank, which is
+// lexicographically smallest when comparing graph node names in sub node name
+// order. A nil rank function ranks every mapping equally.
+func canonical(m map[string]string, auts []map[string]string, rank func(m map[string]string) int) map[string]string {
+	// Sort keys to make the algorithm deterministic.
+	var snames []string
+	for sname := range m {
+		snames = append(snames, sname)
+	}
+	sort.Strings(snames)
+
+	var min map[string]string
+	minRank := 0
+	for _, aut := range auts {
+		cur := make(map[string]string, len(m))
+		for sname := range m {
+			cur[sname] = m[aut[sname]]
+		}
+		curRank := 0
+		if rank != nil {
+			curRank = rank(cur)
+		}
+		if min == nil || curRank < minRank || (curRank == minRank && less(cur, min, snames)) {
+			min, minRank = cur, curRank
+		}
+	}
+	if min == nil {
+		return m
+	}
+	return min
+}
+
+// less returns true if the mapping x is lexicographically smaller than y when
+// comparing graph node names in the order of snames, and false otherwise.
+func less(x, y map[string]string, snames []string) bool {
+	for _, sname := range snames {
+		if x[sname] != y[sname] {
+			return x[sname] < y[sname]
+		}
+	}
+	return false
+}
+
+// mappingKey returns a string representation of m, which is unique for each
+// mapping.
+func mappingKey(m map[string]string) string {
+	var pairs []string
+	for sname, gname := range m {
+		pairs = append(pairs, sname+"\x00"+gname)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "\x01")
+}
@@ -1,8 +1,6 @@
 package iso
 
 import (
-	"sort"
-
 	"decomp.org/x/graphs"
 	"github.com/mewfork/dot"
 	"github.com/mewkiz/pkg/errutil"
@@ -11,26 +9,25 @@ import (
 // solveBrute tries to solve the node pair equation through brute force. It
 // recursively locates and attempts to solve the easiest node pair (i.e. the one
 // with the fewest number of candidates) until the equation is solved, or until
-// all potential solutions have been exhausted.
+// all potential solutions have been exhausted. Constraints are propagated
+// before each node pair is attempted.
 func (eq *equation) solveBrute(graph *dot.Graph, sub *graphs.SubGraph) (m map[string]string, err error) {
+	if err := eq.propagate(); err != nil {
+		return nil, errutil.New("unable to locate node pair mapping")
+	}
 	if eq.isValid(graph, sub) {
-		return eq.m, nil
+		return eq.mapping(), nil
 	}
-	sname, err := eq.easiest()
+	s, err := eq.easiest()
 	if err != nil {
 		return nil, err
 	}
 
-	// Sort candidates to make the algorithm deterministic.
-	candidates := make([]string, 0, len(eq.c[sname]))
-	for gname := range eq.c[sname] {
-		candidates = append(candidates, gname)
-	}
-	sort.Strings(candidates)
-
-	for _, gname := range candidates {
+	// Candidates are sorted by graph node ID, which makes the algorithm
+	// deterministic.
+	for _, g := range eq.c[s].ids() {
 		dup := eq.dup()
-		err = dup.setPair(sname, gname)
+		err = dup.setPair(s, g)
 		if err != nil {
 			continue
 		}
@@ -44,27 +41,56 @@ func (eq *equation) solveBrute(graph *dot.Graph, sub *graphs.SubGraph) (m map[st
 	return nil, errutil.New("unable to locate node pair mapping")
 }
 
-// easiest returns the sub node name of the easiest node pair (i.e. the one with
-// the fewest number of candidates) to solve.
-func (eq *equation) easiest() (string, error) {
-	// Sort keys to make the algorithm deterministic.
-	var snames []string
-	for sname := range eq.c {
-		snames = append(snames, sname)
+// solveAll tries to solve the node pair equation through brute force. It
+// recursively locates and attempts to solve the easiest node pair until the
+// equation is solved, and returns every solution located once all potential
+// solutions have been exhausted. Constraints are propagated before each node
+// pair is attempted.
+func (eq *equation) solveAll(graph *dot.Graph, sub *graphs.SubGraph) []map[string]string {
+	if err := eq.propagate(); err != nil {
+		return nil
+	}
+	if eq.isValid(graph, sub) {
+		return []map[string]string{eq.mapping()}
+	}
+	s, err := eq.easiest()
+	if err != nil {
+		return nil
 	}
-	sort.Strings(snames)
 
+	// Candidates are sorted by graph node ID, which makes the algorithm
+	// deterministic.
+	var ms []map[string]string
+	for _, g := range eq.c[s].ids() {
+		dup := eq.dup()
+		err = dup.setPair(s, g)
+		if err != nil {
+			continue
+		}
+		ms = append(ms, dup.solveAll(graph, sub)...)
+	}
+	return ms
+}
+
+// easiest returns the sub node of the easiest node pair (i.e. the one with the
+// fewest number of candidates) to solve.
+func (eq *equation) easiest() (int, error) {
+	// Sub node IDs are assigned in sorted node name order, which makes the
+	// algorithm deterministic.
 	min := -1
-	var easiest string
-	for _, sname := range snames {
-		candidates := eq.c[sname]
-		if min == -1 || len(candidates) < min {
-			min = len(candidates)
-			easiest = sname
+	easiest := -1
+	for s, candidates := range eq.c {
+		if candidates == nil {
+			continue
+		}
+		n := candidates.count()
+		if min == -1 || n < min {
+			min = n
+			easiest = s
 		}
 	}
 	if min < 1 {
-		return "", errutil.Newf("too few candidates for brute force; expected > 1, got %d", min)
+		return -1, errutil.Newf("too few candidates for brute force; expected > 1, got %d", min)
 	}
 	return easiest, nil
 }
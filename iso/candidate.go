@@ -1,45 +1,87 @@
 package iso
 
 import (
-	"fmt"
-
 	"decomp.org/x/graphs"
 	"github.com/mewfork/dot"
 	"github.com/mewkiz/pkg/errutil"
 )
 
 // Equation specifies an equation of node pair candidates and known node pairs.
+// Sub and graph nodes are identified by the node IDs of their compact
+// representations; node names are only used for output.
 type equation struct {
-	// mapping from sub node name to graph node name candidates.
-	c map[string]map[string]bool
-	// mapping from sub node name to graph node name.
-	m map[string]string
+	// compact representation of graph.
+	gi *index
+	// compact representation of sub.
+	si *subIndex
+	// mapping from sub node ID to graph node ID candidates; nil for sub nodes
+	// without candidates and for known node pairs.
+	c []bitset
+	// mapping from sub node ID to graph node ID; -1 for unknown node pairs.
+	m []int
+	// specifies how edge labels are compared when validating a mapping.
+	labels labelMode
+	// statistics of the constraint propagation; shared by all copies of the
+	// equation. May be nil.
+	stats *Stats
+	// diagnosis of constraint failures; shared by all copies of the equation.
+	// May be nil.
+	diag *diagnosis
+}
+
+// labelMode specifies how edge labels are compared when validating a mapping.
+type labelMode int
+
+// Edge label modes.
+const (
+	// Ignore edge labels.
+	labelsIgnore labelMode = iota
+	// Require edge labels of sub to match edge labels of graph.
+	labelsExact
+	// Require edge labels of sub to match edge labels of graph, with the "true"
+	// and "false" labels of the outgoing edges of a node possibly inverted.
+	labelsInverted
+)
+
+// newEquation returns an empty node pair equation of the compact graph
+// representations gi and si.
+func newEquation(gi *index, si *subIndex) *equation {
+	eq := &equation{
+		gi: gi,
+		si: si,
+		c:  make([]bitset, si.len()),
+		m:  make([]int, si.len()),
+	}
+	for s := range eq.m {
+		eq.m[s] = -1
+	}
+	return eq
 }
 
 // candidates locates node pair candidates for an isomorphism of sub in graph
 // which starts at the entry node.
 func candidates(graph *dot.Graph, entry string, sub *graphs.SubGraph) (*equation, error) {
+	return findEquation(newIndex(graph), newSubIndex(sub), entry)
+}
+
+// findEquation locates node pair candidates for an isomorphism of si in gi
+// which starts at the entry node.
+func findEquation(gi *index, si *subIndex, entry string) (*equation, error) {
 	// Sanity checks.
-	g, ok := graph.Nodes.Lookup[entry]
+	g, ok := gi.ids[entry]
 	if !ok {
 		return nil, errutil.Newf("unable to locate entry node %q in graph", entry)
 	}
-	s, ok := sub.Nodes.Lookup[sub.Entry()]
-	if !ok {
-		panic(fmt.Sprintf("unable to locate entry node %q in sub", sub.Entry()))
-	}
-	if !isPotential(g, s, sub) {
-		return nil, errutil.Newf("invalid entry node candidate %q; expected %d successors, got %d", g.Name, len(s.Succs), len(g.Succs))
+	s := si.entry
+	if err := checkEntry(gi, si, g); err != nil {
+		return nil, errutil.Err(err)
 	}
 
 	// Locate candidate node pairs.
-	eq := &equation{
-		c: make(map[string]map[string]bool),
-		m: make(map[string]string),
-	}
-	eq.findCandidates(g, s, sub)
-	if len(eq.c) != len(sub.Nodes.Nodes) {
-		return nil, errutil.Newf("incomplete candidate mapping; expected %d map entites, got %d", len(sub.Nodes.Nodes), len(eq.c))
+	eq := newEquation(gi, si)
+	eq.findCandidates(g, s)
+	if n := eq.nsub(); n != si.len() {
+		return nil, errutil.Newf("incomplete candidate mapping; expected %d map entites, got %d", si.len(), n)
 	}
 
 	return eq, nil
@@ -47,47 +89,89 @@ func candidates(graph *dot.Graph, entry string, sub *graphs.SubGraph) (*equation
 
 // findCandidates recursively locates potential node pairs (g and s) for an
 // isomorphism of sub in graph and adds them to c.
-func (eq *equation) findCandidates(g, s *dot.Node, sub *graphs.SubGraph) {
+func (eq *equation) findCandidates(g, s int) {
 	// Exit early for impossible node pairs.
-	if !isPotential(g, s, sub) {
+	if !isPotential(eq.gi, eq.si, g, s) {
 		return
 	}
 
 	// Prevent infinite cycles.
-	if _, ok := eq.c[s.Name]; ok {
-		if eq.c[s.Name][g.Name] {
-			return
-		}
+	if eq.c[s] != nil && eq.c[s].has(g) {
+		return
 	}
 
 	// Add node pair candidate.
-	if _, ok := eq.c[s.Name]; !ok {
-		eq.c[s.Name] = make(map[string]bool)
-	} else if s.Name == sub.Entry() {
+	if eq.c[s] == nil {
+		eq.c[s] = newBitset(eq.gi.len())
+	} else if s == eq.si.entry {
 		// Locate candidates for the entry node and its immediate successors
 		// exactly once.
 		return
 	}
-	eq.c[s.Name][g.Name] = true
+	eq.c[s].set(g)
 
 	// Recursively locate candidate successor pairs.
-	for _, ssucc := range s.Succs {
-		for _, gsucc := range g.Succs {
-			eq.findCandidates(gsucc, ssucc, sub)
+	for _, ssucc := range eq.si.succs[s] {
+		for _, gsucc := range eq.gi.succs[g] {
+			eq.findCandidates(gsucc, ssucc)
+		}
+	}
+}
+
+// nsub returns the number of sub nodes with either candidates or a known node
+// pair.
+func (eq *equation) nsub() int {
+	n := 0
+	for s := range eq.c {
+		if eq.c[s] != nil || eq.m[s] != -1 {
+			n++
 		}
 	}
+	return n
 }
 
 // isPotential returns true if the graph node g is a potential candidate for the
 // sub node s, and false otherwise.
-func isPotential(g, s *dot.Node, sub *graphs.SubGraph) bool {
+func isPotential(gi *index, si *subIndex, g, s int) bool {
+	return hasDegree(gi, si, g, s) && hasAttrs(gi, si, g, s)
+}
+
+// hasDegree returns true if the number of predecessors and successors of the
+// graph node g match those of the sub node s, and false otherwise.
+func hasDegree(gi *index, si *subIndex, g, s int) bool {
 	// Verify predecessors.
-	if s.Name != sub.Entry() && len(g.Preds) != len(s.Preds) {
+	if s != si.entry && len(gi.preds[g]) != len(si.preds[s]) {
 		return false
 	}
 	// Verify successors.
-	if s.Name != sub.Exit() && len(g.Succs) != len(s.Succs) {
+	if s != si.exit && len(gi.succs[g]) != len(si.succs[s]) {
 		return false
 	}
 	return true
 }
+
+// hasAttrs returns true if the node attributes of the graph node g satisfy the
+// predicates of the sub node s, and false otherwise.
+func hasAttrs(gi *index, si *subIndex, g, s int) bool {
+	for _, p := range si.conds[s] {
+		if !p.Holds(gi.attrs[g]) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkEntry returns an error if the graph node g is not a potential candidate
+// for the entry node of si.
+func checkEntry(gi *index, si *subIndex, g int) error {
+	s := si.entry
+	if !hasDegree(gi, si, g, s) {
+		return errutil.Newf("invalid entry node candidate %q; expected %d successors, got %d", gi.names[g], len(si.succs[s]), len(gi.succs[g]))
+	}
+	for _, p := range si.conds[s] {
+		if !p.Holds(gi.attrs[g]) {
+			return errutil.Newf("invalid entry node candidate %q; predicate %v of node %q not satisfied", gi.names[g], p, si.names[s])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package iso
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"decomp.org/x/graphs"
+)
+
+// Chain returns the graph node names of the chain matched by the given repeat
+// node of sub, in order. The mapping of a match contains the nodes of the chain
+// under the sub node names given by graphs.ChainName; nodes which are not
+// repeat nodes match a chain of a single node.
+func (match *Match) Chain(sname string) []string {
+	var chain []string
+	for i := 0; ; i++ {
+		gname, ok := match.Nodes[graphs.ChainName(sname, i)]
+		if !ok {
+			return chain
+		}
+		chain = append(chain, gname)
+	}
+}
+
+// expansions represents the expansions of a subgraph with repeat nodes, the
+// searches of which are created on demand and shared between the entry nodes
+// and the workers of a search.
+type expansions struct {
+	// compact representation of the subgraph, in which each repeat node is a
+	// single node.
+	si *subIndex
+	// repeat node IDs of si, in sorted node name order.
+	repeats []int
+	// specifies whether each node of si is a repeat node.
+	repeat []bool
+	// automorphisms of the subgraph; nil if every isomorphism should be
+	// enumerated.
+	auts []map[string]string
+	// mutex protects searches.
+	mu sync.Mutex
+	// searches for the expansions created so far, indexed by chain lengths.
+	searches map[string]*search
+}
+
+// newExpansions returns the expansions of sub for the given matcher.
+func newExpansions(matcher Matcher, sub *graphs.SubGraph) *expansions {
+	si := newSubIndex(sub)
+	x := &expansions{
+		si:       si,
+		repeat:   make([]bool, si.len()),
+		searches: make(map[string]*search),
+	}
+	if !matcher.All {
+		x.auts = automorphisms(sub, matcher.Labels)
+	}
+	for _, name := range sub.Repeats() {
+		s := si.id(name)
+		x.repeats = append(x.repeats, s)
+		x.repeat[s] = true
+	}
+	return x
+}
+
+// chainLengths returns the chain lengths of the repeat nodes of sub for each
+// expansion of sub which may have an isomorphism starting at the entry node, in
+// order of preference; see expansions.lengths.
+func (srch *search) chainLengths(entry string) []map[string]int {
+	g, ok := srch.gi.ids[entry]
+	if !ok {
+		return nil
+	}
+	return srch.chains.lengths(srch.gi, g)
+}
+
+// expand returns the search for the expansion of sub with the given chain
+// lengths, which shares the matcher of srch. Repeat nodes without a specified
+// length are replaced by a chain of a single node.
+func (srch *search) expand(lengths map[string]int) *search {
+	x := srch.chains
+	key := fmt.Sprint(lengths)
+	x.mu.Lock()
+	s, ok := x.searches[key]
+	if !ok {
+		expanded, err := srch.sub.Expand(lengths)
+		if err != nil {
+			// Unreachable; the expansion of a valid subgraph is valid.
+			x.mu.Unlock()
+			panic(err)
+		}
+		// The automorphisms of large expansions are costly to locate; derive
+		// them from the automorphisms of sub instead.
+		s = &search{
+			matcher: srch.matcher,
+			graph:   srch.graph,
+			sub:     expanded,
+			gi:      srch.gi,
+			si:      newSubIndex(expanded),
+			auts:    x.expandAuts(lengths),
+		}
+		x.searches[key] = s
+	}
+	x.mu.Unlock()
+	c := *s
+	c.matcher = srch.matcher
+	return &c
+}
+
+// expandAuts returns the automorphisms of the expansion with the given chain
+// lengths; i.e. the automorphisms of the subgraph which map each repeat node to
+// a node with a chain of the same length, extended to the nodes of the chains.
+// The result is nil if every isomorphism should be enumerated.
+func (x *expansions) expandAuts(lengths map[string]int) []map[string]string {
+	if x.auts == nil {
+		return nil
+	}
+	length := func(name string) int {
+		if n := lengths[name]; n > 1 {
+			return n
+		}
+		return 1
+	}
+	var auts []map[string]string
+next:
+	for _, aut := range x.auts {
+		m := make(map[string]string)
+		for from, to := range aut {
+			n := length(from)
+			if length(to) != n {
+				continue next
+			}
+			m[from] = to
+			for i := 1; i < n; i++ {
+				m[graphs.ChainName(from, i)] = graphs.ChainName(to, i)
+			}
+		}
+		auts = append(auts, m)
+	}
+	return auts
+}
+
+// lengths returns the chain lengths of the repeat nodes for each expansion
+// which may have an isomorphism starting at the graph node g, in order of
+// preference. Longer chains are preferred, and the repeat nodes are considered
+// in sorted node name order.
+//
+// The chain matched by a repeat node is a prefix of the straight-line sequence
+// of nodes starting at the first node of the chain; i.e. the sequence on which
+// each node except the last has a single successor, and each node except the
+// first has a single predecessor. Candidate chains are located by following
+// the edges of the subgraph from the entry node, as for node pair candidates,
+// continuing from the last node of each candidate chain. The chain lengths of a
+// repeat node are thereby limited to those of the candidate chains reachable
+// from g.
+func (x *expansions) lengths(gi *index, g int) []map[string]int {
+	// Locate the candidate chain lengths of each repeat node.
+	found := make([]map[int]bool, x.si.len())
+	visited := make([]bitset, x.si.len())
+	var visit func(g, s int)
+	visit = func(g, s int) {
+		if visited[s] == nil {
+			visited[s] = newBitset(gi.len())
+		} else if visited[s].has(g) || s == x.si.entry {
+			// Locate candidates for the entry node exactly once.
+			return
+		}
+		visited[s].set(g)
+		if !x.isPotential(gi, g, s) {
+			return
+		}
+		if !x.repeat[s] {
+			for _, ssucc := range x.si.succs[s] {
+				for _, gsucc := range gi.succs[g] {
+					visit(gsucc, ssucc)
+				}
+			}
+			return
+		}
+		// The last node of the chain has the successors of the repeat node.
+		n := 1
+		for h := g; h != -1 && hasAttrs(gi, x.si, h, s); h = gi.next(h) {
+			if x.hasSuccs(gi, h, s) {
+				if found[s] == nil {
+					found[s] = make(map[int]bool)
+				}
+				found[s][n] = true
+				for _, ssucc := range x.si.succs[s] {
+					for _, gsucc := range gi.succs[h] {
+						visit(gsucc, ssucc)
+					}
+				}
+			}
+			if gi.next(h) == g {
+				// Straight-line cycle.
+				break
+			}
+			n++
+		}
+	}
+	visit(g, x.si.entry)
+
+	// Combine the chain lengths of the repeat nodes in order of preference.
+	var all []map[string]int
+	lengths := make(map[string]int)
+	var gen func(i int)
+	gen = func(i int) {
+		if i == len(x.repeats) {
+			m := make(map[string]int)
+			for name, n := range lengths {
+				m[name] = n
+			}
+			all = append(all, m)
+			return
+		}
+		s := x.repeats[i]
+		var ns []int
+		for n := range found[s] {
+			ns = append(ns, n)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(ns)))
+		for _, n := range ns {
+			lengths[x.si.names[s]] = n
+			gen(i + 1)
+		}
+	}
+	gen(0)
+	return all
+}
+
+// isPotential reports whether the graph node g is a potential candidate for
+// the sub node s, or for the first node of its chain if s is a repeat node.
+func (x *expansions) isPotential(gi *index, g, s int) bool {
+	if !x.repeat[s] {
+		return isPotential(gi, x.si, g, s)
+	}
+	// The first node of the chain has the predecessors of the repeat node.
+	if s != x.si.entry && len(gi.preds[g]) != len(x.si.preds[s]) {
+		return false
+	}
+	return hasAttrs(gi, x.si, g, s)
+}
+
+// hasSuccs reports whether the graph node g may be the last node of the chain
+// of the repeat node s; i.e. whether g has the successors of s, and each
+// successor of s has a potential candidate among them.
+func (x *expansions) hasSuccs(gi *index, g, s int) bool {
+	if len(gi.succs[g]) != len(x.si.succs[s]) {
+		return false
+	}
+	for _, ssucc := range x.si.succs[s] {
+		ok := false
+		for _, gsucc := range gi.succs[g] {
+			if x.isPotential(gi, gsucc, ssucc) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// next returns the successor of the graph node g in a straight-line sequence of
+// nodes, or -1 if g is the last node of the sequence.
+func (gi *index) next(g int) int {
+	if len(gi.succs[g]) != 1 {
+		return -1
+	}
+	succ := gi.succs[g][0]
+	if succ == g || len(gi.preds[succ]) != 1 {
+		return -1
+	}
+	return succ
+}
@@ -0,0 +1,271 @@
+package iso
+
+import (
+	"fmt"
+
+	"decomp.org/x/graphs"
+	"github.com/mewfork/dot"
+)
+
+// A Reason specifies the constraint which prevented an isomorphism from being
+// located.
+type Reason int
+
+// Isomorphism failure reasons.
+const (
+	// ReasonNone specifies that an isomorphism was located.
+	ReasonNone Reason = iota
+	// ReasonUnknown specifies that no isomorphism was located, without a known
+	// reason.
+	ReasonUnknown
+	// ReasonMissingNode specifies that the entry node is not present in graph.
+	ReasonMissingNode
+	// ReasonDegree specifies that the number of predecessors or successors of a
+	// graph node differs from that of the sub node.
+	ReasonDegree
+	// ReasonMissingEdge specifies that an edge of sub has no corresponding edge
+	// in graph.
+	ReasonMissingEdge
+	// ReasonDuplicate specifies that two sub nodes would map to the same graph
+	// node.
+	ReasonDuplicate
+	// ReasonDominance specifies that the graph node mapped to the entry node of
+	// sub does not dominate the graph node mapped to the exit node.
+	ReasonDominance
+	// ReasonLabel specifies that the edge labels of sub do not match the edge
+	// labels of graph.
+	ReasonLabel
+	// ReasonPostDominance specifies that the graph node mapped to the exit node
+	// of sub does not post-dominate the graph node mapped to the entry node;
+	// only checked when single-entry/single-exit regions are required.
+	ReasonPostDominance
+	// ReasonAttribute specifies that the node attributes of a graph node do not
+	// satisfy the predicates of the sub node.
+	ReasonAttribute
+)
+
+// String returns a string representation of the reason.
+func (reason Reason) String() string {
+	m := map[Reason]string{
+		ReasonNone:          "isomorphism found",
+		ReasonUnknown:       "unknown failure",
+		ReasonMissingNode:   "missing node",
+		ReasonDegree:        "degree mismatch",
+		ReasonMissingEdge:   "missing edge",
+		ReasonDuplicate:     "duplicate mapping",
+		ReasonDominance:     "domination failure",
+		ReasonLabel:         "edge label mismatch",
+		ReasonPostDominance: "post-domination failure",
+		ReasonAttribute:     "node attribute mismatch",
+	}
+	if s, ok := m[reason]; ok {
+		return s
+	}
+	return fmt.Sprintf("unknown reason %d", int(reason))
+}
+
+// An Explanation describes the outcome of an isomorphism search of a subgraph
+// in a graph which starts at a given entry node. When no isomorphism could be
+// located, it records the constraint which failed with the most node pairs
+// known; i.e. the failure closest to a complete mapping.
+type Explanation struct {
+	// Entry node name in graph.
+	Entry string
+	// Constraint which prevented an isomorphism; ReasonNone if an isomorphism
+	// was located.
+	Reason Reason
+	// Name of the sub node which blocked the isomorphism; empty if unknown.
+	Sub string
+	// Name of the graph node which was considered for the sub node; empty if
+	// unknown.
+	Node string
+	// Known node pairs at the point of failure, or the complete mapping of the
+	// isomorphism located.
+	Nodes map[string]string
+}
+
+// String returns a string representation of the explanation.
+func (e *Explanation) String() string {
+	s := fmt.Sprintf("entry node %q: %v", e.Entry, e.Reason)
+	if len(e.Sub) > 0 {
+		s += fmt.Sprintf(" at sub node %q", e.Sub)
+	}
+	if len(e.Node) > 0 {
+		s += fmt.Sprintf(" (graph node %q)", e.Node)
+	}
+	return s
+}
+
+// Explain reports why an isomorphism of sub in graph which starts at the entry
+// node could or could not be located. The explanation is always computed by
+// the brute force engine, independent of the engine of the matcher. When
+// matching edge labels, the branch polarity of nodes may be inverted.
+func (matcher Matcher) Explain(graph *dot.Graph, entry string, sub *graphs.SubGraph) *Explanation {
+	return matcher.newSearch(graph, sub).explain(entry)
+}
+
+// ExplainAll reports, for every entry node of graph in sorted order, why an
+// isomorphism of sub which starts at the entry node could or could not be
+// located.
+func (matcher Matcher) ExplainAll(graph *dot.Graph, sub *graphs.SubGraph) []*Explanation {
+	srch := matcher.newSearch(graph, sub)
+	var es []*Explanation
+	for _, name := range srch.gi.names {
+		es = append(es, srch.explain(name))
+	}
+	return es
+}
+
+// explain reports why an isomorphism of sub in graph which starts at the entry
+// node could or could not be located.
+func (srch *search) explain(entry string) *Explanation {
+	if srch.chains != nil {
+		// Report the first expansion of sub with an isomorphism, or the
+		// failure of the expansion with the shortest chains. Without candidate
+		// chains, report the failure of the expansion with single node chains.
+		all := srch.chainLengths(entry)
+		if len(all) == 0 {
+			all = append(all, nil)
+		}
+		var e *Explanation
+		for _, lengths := range all {
+			e = srch.expand(lengths).explain(entry)
+			if e.Reason == ReasonNone {
+				break
+			}
+		}
+		return e
+	}
+	labels := labelsIgnore
+	if srch.matcher.Labels {
+		labels = labelsInverted
+	}
+	d := &diagnosis{depth: -1}
+	eq, err := findEquation(srch.gi, srch.si, entry)
+	if err != nil {
+		d.failEntry(srch.gi, srch.si, entry)
+		return d.explanation(entry)
+	}
+	eq.labels = labels
+	eq.diag = d
+	m, err := eq.solveBrute(srch.graph, srch.sub)
+	if err != nil {
+		return d.explanation(entry)
+	}
+	return &Explanation{Entry: entry, Reason: ReasonNone, Nodes: m}
+}
+
+// diagnosis records the constraint failure of a brute force search with the
+// most node pairs known; shared by all copies of an equation.
+type diagnosis struct {
+	// Number of known node pairs at the point of failure; -1 if no failure has
+	// been recorded.
+	depth int
+	// Constraint which failed.
+	reason Reason
+	// Sub node which blocked the isomorphism; empty if unknown.
+	sub string
+	// Graph node considered for the sub node; empty if unknown.
+	node string
+	// Known node pairs at the point of failure.
+	nodes map[string]string
+}
+
+// failEntry records the reason why the entry node of si could not be mapped to
+// the given entry node of gi.
+func (d *diagnosis) failEntry(gi *index, si *subIndex, entry string) {
+	d.depth = 0
+	d.sub = si.names[si.entry]
+	g, ok := gi.ids[entry]
+	if !ok {
+		d.reason = ReasonMissingNode
+		d.node = entry
+		return
+	}
+	if !hasDegree(gi, si, g, si.entry) {
+		d.reason = ReasonDegree
+		d.node = entry
+		return
+	}
+	if !hasAttrs(gi, si, g, si.entry) {
+		d.reason = ReasonAttribute
+		d.node = entry
+		return
+	}
+
+	// Locate the first sub node without candidates. Sub node IDs are assigned
+	// in sorted node name order, which makes the algorithm deterministic.
+	eq := newEquation(gi, si)
+	eq.findCandidates(g, si.entry)
+	d.reason = ReasonDegree
+	for s := range eq.c {
+		if eq.c[s] == nil {
+			d.sub = si.names[s]
+			// Report graph nodes reached from the candidates of the predecessors
+			// of the sub node, which only fail its predicates.
+			if h, ok := eq.attrFailure(s); ok {
+				d.reason = ReasonAttribute
+				d.node = gi.names[h]
+			}
+			break
+		}
+	}
+	d.nodes = map[string]string{si.names[si.entry]: entry}
+}
+
+// attrFailure returns a successor of the candidates of the predecessors of the
+// sub node s, with the degree of s but node attributes which do not satisfy the
+// predicates of s. The boolean value is true if such a graph node exists, and
+// false otherwise.
+func (eq *equation) attrFailure(s int) (h int, ok bool) {
+	for _, spred := range eq.si.preds[s] {
+		if eq.c[spred] == nil {
+			continue
+		}
+		for _, g := range eq.c[spred].ids() {
+			for _, h := range eq.gi.succs[g] {
+				if hasDegree(eq.gi, eq.si, h, s) && !hasAttrs(eq.gi, eq.si, h, s) {
+					return h, true
+				}
+			}
+		}
+	}
+	return -1, false
+}
+
+// explanation returns the explanation of the failure recorded by d.
+func (d *diagnosis) explanation(entry string) *Explanation {
+	if d.depth == -1 {
+		return &Explanation{Entry: entry, Reason: ReasonUnknown}
+	}
+	return &Explanation{Entry: entry, Reason: d.reason, Sub: d.sub, Node: d.node, Nodes: d.nodes}
+}
+
+// fail records the failure of a constraint involving the sub node s and the
+// graph node g, unless a failure with more node pairs known has already been
+// recorded. Either s or g may be -1 if unknown.
+func (eq *equation) fail(reason Reason, s, g int) {
+	d := eq.diag
+	if d == nil {
+		return
+	}
+	depth := 0
+	for _, x := range eq.m {
+		if x != -1 {
+			depth++
+		}
+	}
+	if depth <= d.depth {
+		return
+	}
+	d.depth = depth
+	d.reason = reason
+	d.sub, d.node = "", ""
+	if s != -1 {
+		d.sub = eq.si.names[s]
+	}
+	if g != -1 {
+		d.node = eq.gi.names[g]
+	}
+	d.nodes = eq.mapping()
+}
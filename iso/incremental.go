@@ -0,0 +1,139 @@
+package iso
+
+import (
+	"sort"
+
+	"decomp.org/x/graphs"
+	"github.com/mewfork/dot"
+)
+
+// An Incremental locates isomorphisms of a subgraph in a graph which is
+// repeatedly modified by merging isomorphisms into single nodes (e.g. by
+// merge.Merge). The result of each entry node is cached between searches, and
+// only the entry nodes within a bounded neighbourhood of a merged node are
+// re-examined after a merge.
+//
+// The isomorphisms located are identical to those located by Search on the
+// modified graph, provided that every merge of graph is reported to Merged.
+type Incremental struct {
+	matcher Matcher
+	graph   *dot.Graph
+	sub     *graphs.SubGraph
+	// maximum distance from the entry node of sub to any node of sub; -1 if
+	// unbounded, as for subgraphs with repeat nodes.
+	radius int
+	// mapping from entry node name to the isomorphism which starts at the node;
+	// nil if no such isomorphism exists. Entry nodes which have not been
+	// examined since the last merge in their neighbourhood are omitted.
+	cache map[string]*Match
+}
+
+// NewIncremental returns an incremental search for isomorphisms of sub in
+// graph.
+func (matcher Matcher) NewIncremental(graph *dot.Graph, sub *graphs.SubGraph) *Incremental {
+	return &Incremental{
+		matcher: matcher,
+		graph:   graph,
+		sub:     sub,
+		radius:  radius(sub),
+		cache:   make(map[string]*Match),
+	}
+}
+
+// Search tries to locate an isomorphism of sub in graph. If successful it
+// returns the first isomorphism located, ordered by entry node name. The
+// boolean value is true if such an isomorphism could be located, and false
+// otherwise.
+func (inc *Incremental) Search() (match *Match, ok bool) {
+	var names []string
+	for name := range inc.graph.Nodes.Lookup {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var srch *search
+	for _, name := range names {
+		match, ok := inc.cache[name]
+		if !ok {
+			// The compact representation of graph is only computed if an entry
+			// node has to be re-examined.
+			if srch == nil {
+				srch = inc.matcher.newSearch(inc.graph, inc.sub)
+			}
+			match, _ = srch.isomorphism(name)
+			inc.cache[name] = match
+		}
+		if match != nil {
+			return match, true
+		}
+	}
+	return nil, false
+}
+
+// Merged records that an isomorphism located in graph has been merged into the
+// node with the given name. Any cached dominator trees of the matcher must be
+// invalidated by the merge; e.g. by passing the cache to merge.Merge.
+//
+// Merging the nodes of an isomorphism into a single node preserves the
+// dominance relation of the remaining nodes. As only the entry node of the
+// isomorphism has incoming edges from, and only the exit node has outgoing
+// edges to, nodes outside of the isomorphism, the result of an entry node may
+// only change if the merged node is reachable from the entry node within the
+// radius of sub. Those entry nodes are re-examined by the next search. As the
+// chains of repeat nodes have no bound, every entry node which reaches the
+// merged node is re-examined for subgraphs with repeat nodes.
+func (inc *Incremental) Merged(name string) {
+	// Forget the results of merged nodes.
+	for entry := range inc.cache {
+		if _, ok := inc.graph.Nodes.Lookup[entry]; !ok {
+			delete(inc.cache, entry)
+		}
+	}
+	// Forget the results of entry nodes which reach the merged node within the
+	// radius of sub; i.e. a breadth-first traversal of predecessors.
+	node, ok := inc.graph.Nodes.Lookup[name]
+	if !ok {
+		return
+	}
+	dist := map[string]int{name: 0}
+	queue := []*dot.Node{node}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		delete(inc.cache, n.Name)
+		if inc.radius != -1 && dist[n.Name] == inc.radius {
+			continue
+		}
+		for _, pred := range n.Preds {
+			if _, ok := dist[pred.Name]; !ok {
+				dist[pred.Name] = dist[n.Name] + 1
+				queue = append(queue, pred)
+			}
+		}
+	}
+}
+
+// radius returns the maximum distance from the entry node of sub to any node of
+// sub reachable from it, or -1 if sub has repeat nodes.
+func radius(sub *graphs.SubGraph) int {
+	if len(sub.Repeats()) > 0 {
+		return -1
+	}
+	entry := sub.Entry()
+	dist := map[string]int{entry: 0}
+	queue := []string{entry}
+	max := 0
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if dist[name] > max {
+			max = dist[name]
+		}
+		for _, succ := range sub.Nodes.Lookup[name].Succs {
+			if _, ok := dist[succ.Name]; !ok {
+				dist[succ.Name] = dist[name] + 1
+				queue = append(queue, succ.Name)
+			}
+		}
+	}
+	return max
+}
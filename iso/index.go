@@ -0,0 +1,215 @@
+package iso
+
+import (
+	"fmt"
+	"sort"
+
+	"decomp.org/x/graphs"
+	"decomp.org/x/graphs/dom"
+	"github.com/mewfork/dot"
+)
+
+// index is a compact representation of a graph, with dense integer node IDs
+// and adjacency slices. Node IDs are assigned in sorted node name order, so
+// iterating over node IDs in increasing order is deterministic and equivalent
+// to iterating over sorted node names.
+type index struct {
+	// mapping from node ID to node name.
+	names []string
+	// mapping from node name to node ID.
+	ids map[string]int
+	// successor node IDs of each node, in increasing order.
+	succs [][]int
+	// predecessor node IDs of each node, in increasing order.
+	preds [][]int
+	// set of successor node IDs of each node.
+	adj []bitset
+	// edge labels; edges without labels are omitted.
+	labels map[edge]string
+	// node attributes of each node.
+	attrs []map[string]string
+	// dominator tree of the graph; nil if not computed.
+	dom *dom.Tree
+	// post-dominator tree of the graph; nil unless single-entry/single-exit
+	// regions are required.
+	pdom *dom.Tree
+}
+
+// edge represents a directed edge between two nodes of an index.
+type edge struct {
+	src, dst int
+}
+
+// newIndex returns a compact representation of graph.
+func newIndex(graph *dot.Graph) *index {
+	var names []string
+	for name := range graph.Nodes.Lookup {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	n := len(names)
+	x := &index{
+		names:  names,
+		ids:    make(map[string]int, n),
+		succs:  make([][]int, n),
+		preds:  make([][]int, n),
+		adj:    make([]bitset, n),
+		labels: make(map[edge]string),
+		attrs:  make([]map[string]string, n),
+	}
+	for id, name := range names {
+		x.ids[name] = id
+	}
+	for id, name := range names {
+		node := graph.Nodes.Lookup[name]
+		x.attrs[id] = node.Attrs
+		x.adj[id] = newBitset(n)
+		for _, succ := range node.Succs {
+			sid := x.ids[succ.Name]
+			x.succs[id] = append(x.succs[id], sid)
+			x.adj[id].set(sid)
+			if e, ok := graph.Edges.SrcToDsts[name][succ.Name]; ok {
+				if label, ok := e.Attrs["label"]; ok {
+					x.labels[edge{src: id, dst: sid}] = label
+				}
+			}
+		}
+		for _, pred := range node.Preds {
+			x.preds[id] = append(x.preds[id], x.ids[pred.Name])
+		}
+		sort.Ints(x.succs[id])
+		sort.Ints(x.preds[id])
+	}
+	return x
+}
+
+// subIndex is a compact representation of a subgraph with a dedicated entry
+// and exit node.
+type subIndex struct {
+	*index
+	// entry and exit node IDs; exit is -1 if the subgraph has no exit node.
+	entry, exit int
+	// node attribute predicates of each node.
+	conds [][]*graphs.Predicate
+}
+
+// newSubIndex returns a compact representation of sub.
+func newSubIndex(sub *graphs.SubGraph) *subIndex {
+	x := &subIndex{index: newIndex(sub.Graph), exit: -1}
+	x.entry = x.id(sub.Entry())
+	if exit := sub.Exit(); len(exit) > 0 {
+		x.exit = x.id(exit)
+	}
+	x.conds = make([][]*graphs.Predicate, x.len())
+	for id, name := range x.names {
+		x.conds[id] = sub.Predicates(name)
+	}
+	return x
+}
+
+// dominates reports whether the graph node g dominates the graph node h. The
+// dominator tree of graph is computed unless already present in the index.
+func (x *index) dominates(graph *dot.Graph, g, h int) bool {
+	tree := x.dom
+	if tree == nil {
+		tree = dom.New(graph)
+	}
+	return tree.Dominates(x.names[g], x.names[h])
+}
+
+// isSESE reports whether the graph node h post-dominates the graph node g, if
+// single-entry/single-exit regions are required; i.e. whether every path from g
+// to an exit of the graph passes through h. It always returns true if the
+// index has no post-dominator tree.
+func (x *index) isSESE(g, h int) bool {
+	if x.pdom == nil {
+		return true
+	}
+	return x.pdom.Dominates(x.names[h], x.names[g])
+}
+
+// id returns the node ID of the given node name.
+func (x *index) id(name string) int {
+	id, ok := x.ids[name]
+	if !ok {
+		panic(fmt.Sprintf("unable to locate node %q", name))
+	}
+	return id
+}
+
+// len returns the number of nodes in x.
+func (x *index) len() int {
+	return len(x.names)
+}
+
+// hasEdge returns true if there exists an edge from src to dst, and false
+// otherwise.
+func (x *index) hasEdge(src, dst int) bool {
+	return x.adj[src].has(dst)
+}
+
+// label returns the label of the edge from src to dst, or an empty string if
+// the edge has no label.
+func (x *index) label(src, dst int) string {
+	return x.labels[edge{src: src, dst: dst}]
+}
+
+// bitset is a set of node IDs.
+type bitset []uint64
+
+// newBitset returns an empty set with room for n node IDs.
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+// set adds id to the set.
+func (b bitset) set(id int) {
+	b[id/64] |= 1 << uint(id%64)
+}
+
+// clear removes id from the set.
+func (b bitset) clear(id int) {
+	b[id/64] &^= 1 << uint(id%64)
+}
+
+// has returns true if id is in the set, and false otherwise.
+func (b bitset) has(id int) bool {
+	return b[id/64]&(1<<uint(id%64)) != 0
+}
+
+// count returns the number of node IDs in the set.
+func (b bitset) count() int {
+	n := 0
+	for _, w := range b {
+		for ; w != 0; w &= w - 1 {
+			n++
+		}
+	}
+	return n
+}
+
+// key returns a string representation of the set, which is unique for each
+// set of the same capacity.
+func (b bitset) key() string {
+	buf := make([]byte, 0, 8*len(b))
+	for _, w := range b {
+		for i := uint(0); i < 64; i += 8 {
+			buf = append(buf, byte(w>>i))
+		}
+	}
+	return string(buf)
+}
+
+// ids returns the node IDs of the set, in increasing order.
+func (b bitset) ids() []int {
+	var ids []int
+	for i, w := range b {
+		for j := 0; w != 0; j, w = j+1, w>>1 {
+			if w&1 != 0 {
+				ids = append(ids, i*64+j)
+			}
+		}
+	}
+	return ids
+}
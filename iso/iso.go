@@ -2,26 +2,83 @@
 package iso
 
 import (
-	"sort"
-
 	"decomp.org/x/graphs"
+	"decomp.org/x/graphs/dom"
 	"github.com/mewfork/dot"
 )
 
+// A Matcher locates isomorphisms of subgraphs in graphs. The zero value is a
+// valid matcher which ignores edge labels.
+type Matcher struct {
+	// When Labels is true, the edge labels of sub are required to match the
+	// corresponding edge labels of graph. The "true" and "false" labels of the
+	// outgoing edges of a node may be inverted, in which case the node is
+	// reported as having an inverted branch polarity.
+	Labels bool
+	// When All is true, every isomorphism is enumerated; including those which
+	// only differ by an automorphism of sub (e.g. swapping the interchangeable
+	// branches of an if-else primitive). Otherwise, equivalent isomorphisms are
+	// collapsed into a single canonical match.
+	All bool
+	// Engine specifies the algorithm used to locate isomorphisms.
+	Engine Engine
+	// When Stats is non-nil, the number of node pair candidates eliminated by
+	// each phase of the constraint propagation is accumulated into it. Only
+	// used by the brute force engine.
+	Stats *Stats
+	// When Dom is non-nil, the dominator trees of graphs are cached across
+	// searches. The cached tree of a graph must be invalidated once the graph
+	// is modified; e.g. by passing Dom to merge.Merge. Otherwise, the dominator
+	// tree of graph is computed once per search.
+	Dom *dom.Cache
+	// When SESE is true, matches are required to be single-entry/single-exit
+	// regions of graph; i.e. the graph node mapped to the exit node of sub must
+	// post-dominate the graph node mapped to the entry node, in addition to being
+	// dominated by it. This prevents control flow from leaving the match through
+	// intermediate nodes. Nodes which cannot reach an exit of graph (e.g. nodes
+	// of infinite loops) are only post-dominated by themselves. Subgraphs without
+	// an exit node are not affected.
+	SESE bool
+	// Workers specifies the number of entry nodes searched concurrently by
+	// SearchContext and SearchAllContext. A value below 1 uses one worker per
+	// available CPU.
+	Workers int
+}
+
+// Engine specifies the algorithm used to locate isomorphisms.
+type Engine int
+
+// Isomorphism search engines.
+const (
+	// EngineBrute solves the node pair candidate equation through brute force.
+	EngineBrute Engine = iota
+	// EngineVF2 uses the VF2 algorithm, which extends a single mapping in place
+	// while backtracking.
+	EngineVF2
+)
+
+// A Match represents an isomorphism of a subgraph in a graph.
+type Match struct {
+	// Mapping from sub node name to graph node name. The nodes of the chain
+	// matched by a repeat node of sub are mapped from the sub node names given
+	// by graphs.ChainName (e.g. "A", "A.1" and "A.2"); see Chain.
+	Nodes map[string]string
+	// Set of sub node names with an inverted branch polarity; i.e. the "true"
+	// and "false" labels of their outgoing edges are swapped in graph. Only
+	// populated when matching edge labels.
+	Inverted map[string]bool
+}
+
 // Isomorphism returns a mapping from sub node name to graph node name if there
 // exists an isomorphism of sub in graph which starts at the entry node. The
 // boolean value is true if such a mapping could be located, and false
 // otherwise.
 func Isomorphism(graph *dot.Graph, entry string, sub *graphs.SubGraph) (m map[string]string, ok bool) {
-	eq, err := candidates(graph, entry, sub)
-	if err != nil {
+	match, ok := Matcher{}.Isomorphism(graph, entry, sub)
+	if !ok {
 		return nil, false
 	}
-	m, err = eq.solveBrute(graph, sub)
-	if err != nil {
-		return nil, false
-	}
-	return m, true
+	return match.Nodes, true
 }
 
 // Search tries to locate an isomorphism of sub in graph. If successful it
@@ -29,16 +86,257 @@ func Isomorphism(graph *dot.Graph, entry string, sub *graphs.SubGraph) (m map[st
 // isomorphism located. The boolean value is true if such a mapping could be
 // located, and false otherwise.
 func Search(graph *dot.Graph, sub *graphs.SubGraph) (m map[string]string, ok bool) {
-	var names []string
-	for name := range graph.Nodes.Lookup {
-		names = append(names, name)
+	match, ok := Matcher{}.Search(graph, sub)
+	if !ok {
+		return nil, false
+	}
+	return match.Nodes, true
+}
+
+// IsomorphismsAt returns every mapping from sub node name to graph node name of
+// the isomorphisms of sub in graph which start at the entry node. Mappings which
+// only differ by an automorphism of sub are collapsed into a single canonical
+// mapping.
+func IsomorphismsAt(graph *dot.Graph, entry string, sub *graphs.SubGraph) []map[string]string {
+	return mappings(Matcher{}.IsomorphismsAt(graph, entry, sub))
+}
+
+// SearchAll returns every mapping from sub node name to graph node name of the
+// isomorphisms of sub in graph, ordered by entry node name. Mappings which only
+// differ by an automorphism of sub are collapsed into a single canonical
+// mapping.
+func SearchAll(graph *dot.Graph, sub *graphs.SubGraph) []map[string]string {
+	return mappings(Matcher{}.SearchAll(graph, sub))
+}
+
+// mappings returns the node mappings of the given matches.
+func mappings(matches []*Match) []map[string]string {
+	var ms []map[string]string
+	for _, match := range matches {
+		ms = append(ms, match.Nodes)
 	}
-	sort.Strings(names)
-	for _, name := range names {
-		m, ok = Isomorphism(graph, name, sub)
+	return ms
+}
+
+// Isomorphism returns the isomorphism of sub in graph which starts at the entry
+// node. The boolean value is true if such an isomorphism could be located, and
+// false otherwise.
+//
+// When matching edge labels, isomorphisms which preserve the branch polarity of
+// every node are preferred over those which invert it.
+func (matcher Matcher) Isomorphism(graph *dot.Graph, entry string, sub *graphs.SubGraph) (match *Match, ok bool) {
+	return matcher.newSearch(graph, sub).isomorphism(entry)
+}
+
+// Search tries to locate an isomorphism of sub in graph. If successful it
+// returns the first isomorphism located. The boolean value is true if such an
+// isomorphism could be located, and false otherwise.
+func (matcher Matcher) Search(graph *dot.Graph, sub *graphs.SubGraph) (match *Match, ok bool) {
+	srch := matcher.newSearch(graph, sub)
+	for _, name := range srch.gi.names {
+		match, ok = srch.isomorphism(name)
 		if ok {
-			return m, true
+			return match, true
+		}
+	}
+	return nil, false
+}
+
+// IsomorphismsAt returns every isomorphism of sub in graph which starts at the
+// entry node.
+func (matcher Matcher) IsomorphismsAt(graph *dot.Graph, entry string, sub *graphs.SubGraph) []*Match {
+	return matcher.newSearch(graph, sub).isomorphismsAt(entry)
+}
+
+// SearchAll returns every isomorphism of sub in graph, ordered by entry node
+// name.
+func (matcher Matcher) SearchAll(graph *dot.Graph, sub *graphs.SubGraph) []*Match {
+	srch := matcher.newSearch(graph, sub)
+	var matches []*Match
+	for _, name := range srch.gi.names {
+		matches = append(matches, srch.isomorphismsAt(name)...)
+	}
+	return matches
+}
+
+// search represents a search for isomorphisms of sub in graph. The compact
+// representations of graph and sub are computed once and shared between the
+// entry nodes of the search.
+type search struct {
+	matcher Matcher
+	graph   *dot.Graph
+	sub     *graphs.SubGraph
+	// compact representation of graph.
+	gi *index
+	// compact representation of sub.
+	si *subIndex
+	// automorphisms of sub used to collapse equivalent isomorphisms; nil if
+	// every isomorphism should be enumerated.
+	auts []map[string]string
+	// expansions of sub with a chain of nodes in place of each repeat node; nil
+	// if sub has no repeat nodes. The compact representation of sub is nil if
+	// present.
+	chains *expansions
+}
+
+// newSearch returns a new search for isomorphisms of sub in graph.
+func (matcher Matcher) newSearch(graph *dot.Graph, sub *graphs.SubGraph) *search {
+	gi := newIndex(graph)
+	if matcher.Dom != nil {
+		gi.dom = matcher.Dom.Tree(graph)
+	} else {
+		gi.dom = dom.New(graph)
+	}
+	if matcher.SESE {
+		if matcher.Dom != nil {
+			gi.pdom = matcher.Dom.PostTree(graph)
+		} else {
+			gi.pdom = dom.NewPost(graph)
 		}
 	}
+	if len(sub.Repeats()) == 0 {
+		return matcher.newSubSearch(graph, gi, sub)
+	}
+	return &search{
+		matcher: matcher,
+		graph:   graph,
+		sub:     sub,
+		gi:      gi,
+		chains:  newExpansions(matcher, sub),
+	}
+}
+
+// newSubSearch returns a new search for isomorphisms of sub, which has no
+// repeat nodes, in graph with the compact representation gi.
+func (matcher Matcher) newSubSearch(graph *dot.Graph, gi *index, sub *graphs.SubGraph) *search {
+	srch := &search{
+		matcher: matcher,
+		graph:   graph,
+		sub:     sub,
+		gi:      gi,
+		si:      newSubIndex(sub),
+	}
+	if !matcher.All {
+		srch.auts = automorphisms(sub, matcher.Labels)
+	}
+	return srch
+}
+
+// isomorphism returns the isomorphism of sub in graph which starts at the entry
+// node. The boolean value is true if such an isomorphism could be located, and
+// false otherwise.
+func (srch *search) isomorphism(entry string) (match *Match, ok bool) {
+	if srch.chains != nil {
+		for _, lengths := range srch.chainLengths(entry) {
+			if match, ok := srch.expand(lengths).isomorphism(entry); ok {
+				return match, true
+			}
+		}
+		return nil, false
+	}
+	modes := []labelMode{labelsIgnore}
+	if srch.matcher.Labels {
+		modes = []labelMode{labelsExact, labelsInverted}
+	}
+	for _, mode := range modes {
+		m, err := srch.solve(entry, mode)
+		if err != nil {
+			continue
+		}
+		match = &Match{Nodes: m}
+		if mode == labelsInverted {
+			match.Inverted = srch.inverted(m)
+		}
+		return match, true
+	}
 	return nil, false
 }
+
+// isomorphismsAt returns every isomorphism of sub in graph which starts at the
+// entry node. Unless every isomorphism should be enumerated, isomorphisms which
+// only differ by an automorphism of sub are collapsed into a single canonical
+// match. For subgraphs with repeat nodes, only the isomorphisms of the preferred
+// expansion of sub with an isomorphism are returned, as isomorphisms with
+// shorter chains overlap.
+func (srch *search) isomorphismsAt(entry string) []*Match {
+	if srch.chains != nil {
+		for _, lengths := range srch.chainLengths(entry) {
+			if matches := srch.expand(lengths).isomorphismsAt(entry); len(matches) > 0 {
+				return matches
+			}
+		}
+		return nil
+	}
+	mode := labelsIgnore
+	if srch.matcher.Labels {
+		mode = labelsInverted
+	}
+	// When matching edge labels, the automorphisms of sub may invert the branch
+	// polarity of nodes; prefer the equivalent mapping with the fewest inverted
+	// nodes.
+	var rank func(m map[string]string) int
+	if srch.matcher.Labels {
+		rank = func(m map[string]string) int {
+			return len(srch.inverted(m))
+		}
+	}
+	var matches []*Match
+	seen := make(map[string]bool)
+	for _, m := range srch.solveAll(entry, mode) {
+		if srch.auts != nil {
+			m = canonical(m, srch.auts, rank)
+			key := mappingKey(m)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		match := &Match{Nodes: m}
+		if srch.matcher.Labels {
+			match.Inverted = srch.inverted(m)
+		}
+		matches = append(matches, match)
+	}
+	return matches
+}
+
+// inverted returns the set of sub node names with an inverted branch polarity
+// in the mapping m from sub node name to graph node name.
+func (srch *search) inverted(m map[string]string) map[string]bool {
+	ids := make([]int, srch.si.len())
+	for sname, gname := range m {
+		ids[srch.si.id(sname)] = srch.gi.id(gname)
+	}
+	inv, _ := polarity(srch.gi, srch.si, ids)
+	return inv
+}
+
+// solve tries to locate an isomorphism of sub in graph which starts at the
+// entry node, using the engine of the matcher.
+func (srch *search) solve(entry string, labels labelMode) (m map[string]string, err error) {
+	if srch.matcher.Engine == EngineVF2 {
+		return solveVF2(srch.graph, srch.gi, srch.si, entry, labels)
+	}
+	eq, err := findEquation(srch.gi, srch.si, entry)
+	if err != nil {
+		return nil, err
+	}
+	eq.labels = labels
+	eq.stats = srch.matcher.Stats
+	return eq.solveBrute(srch.graph, srch.sub)
+}
+
+// solveAll returns every isomorphism of sub in graph which starts at the entry
+// node, using the engine of the matcher.
+func (srch *search) solveAll(entry string, labels labelMode) []map[string]string {
+	if srch.matcher.Engine == EngineVF2 {
+		return solveAllVF2(srch.graph, srch.gi, srch.si, entry, labels)
+	}
+	eq, err := findEquation(srch.gi, srch.si, entry)
+	if err != nil {
+		return nil
+	}
+	eq.labels = labels
+	eq.stats = srch.matcher.Stats
+	return eq.solveAll(srch.graph, srch.sub)
+}
@@ -1,11 +1,15 @@
 package iso
 
 import (
+	"context"
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"decomp.org/x/graphs"
+	"decomp.org/x/graphs/merge"
 	"github.com/mewfork/dot"
 )
 
@@ -162,8 +166,9 @@ func TestCandidates(t *testing.T) {
 			// Expected error, check next test case.
 			continue
 		}
-		if !reflect.DeepEqual(eq.c, g.want) {
-			t.Errorf("i=%d: candidate map mismatch; expected %v, got %v", i, g.want, eq.c)
+		got := eq.names().c
+		if !reflect.DeepEqual(got, g.want) {
+			t.Errorf("i=%d: candidate map mismatch; expected %v, got %v", i, g.want, got)
 		}
 	}
 }
@@ -277,14 +282,14 @@ loop:
 
 func TestEquationSetPair(t *testing.T) {
 	golden := []struct {
-		in           *equation
+		in           *nameEquation
 		sname, gname string
-		want         *equation
+		want         *nameEquation
 		err          string
 	}{
 		// i=0
 		{
-			in: &equation{
+			in: &nameEquation{
 				c: map[string]map[string]bool{
 					"A": {
 						"A": true,
@@ -304,7 +309,7 @@ func TestEquationSetPair(t *testing.T) {
 				m: map[string]string{},
 			},
 			sname: "A", gname: "A",
-			want: &equation{
+			want: &nameEquation{
 				c: map[string]map[string]bool{
 					"B": {
 						"B": true,
@@ -326,7 +331,7 @@ func TestEquationSetPair(t *testing.T) {
 		},
 		// i=1
 		{
-			in: &equation{
+			in: &nameEquation{
 				c: map[string]map[string]bool{
 					"B": {
 						"B": true,
@@ -345,7 +350,7 @@ func TestEquationSetPair(t *testing.T) {
 				},
 			},
 			sname: "B", gname: "B",
-			want: &equation{
+			want: &nameEquation{
 				c: map[string]map[string]bool{
 					"C": {
 						"C": true,
@@ -363,7 +368,7 @@ func TestEquationSetPair(t *testing.T) {
 		},
 		// i=2
 		{
-			in: &equation{
+			in: &nameEquation{
 				c: map[string]map[string]bool{
 					"B": {
 						"B": true,
@@ -382,7 +387,7 @@ func TestEquationSetPair(t *testing.T) {
 				},
 			},
 			sname: "B", gname: "C",
-			want: &equation{
+			want: &nameEquation{
 				c: map[string]map[string]bool{
 					"C": {
 						"B": true,
@@ -400,7 +405,7 @@ func TestEquationSetPair(t *testing.T) {
 		},
 		// i=3
 		{
-			in: &equation{
+			in: &nameEquation{
 				c: map[string]map[string]bool{
 					"A": {
 						"A": true,
@@ -422,7 +427,7 @@ func TestEquationSetPair(t *testing.T) {
 		},
 		// i=3
 		{
-			in: &equation{
+			in: &nameEquation{
 				c: map[string]map[string]bool{
 					"A": {
 						"0": true,
@@ -440,7 +445,8 @@ func TestEquationSetPair(t *testing.T) {
 	}
 
 	for i, g := range golden {
-		err := g.in.setPair(g.sname, g.gname)
+		eq := g.in.equation()
+		err := eq.setPair(eq.si.id(g.sname), eq.gi.id(g.gname))
 		if !sameError(err, g.err) {
 			t.Errorf("i=%d: error mismatch; expected %v, got %v", i, g.err, err)
 			continue
@@ -448,21 +454,21 @@ func TestEquationSetPair(t *testing.T) {
 			// Expected error, check next test case.
 			continue
 		}
-		if !reflect.DeepEqual(g.in, g.want) {
-			t.Errorf("i=%d: node pair equation mismatch; expected %v, got %v", i, g.want, g.in)
+		if got := eq.names(); !reflect.DeepEqual(got, g.want) {
+			t.Errorf("i=%d: node pair equation mismatch; expected %v, got %v", i, g.want, got)
 		}
 	}
 }
 
 func TestEquationDup(t *testing.T) {
 	golden := []struct {
-		in         *equation
+		in         *nameEquation
 		ckey, mkey string
-		want       *equation
+		want       *nameEquation
 	}{
 		// i=0
 		{
-			in: &equation{
+			in: &nameEquation{
 				c: map[string]map[string]bool{
 					"A": {
 						"A": true,
@@ -482,7 +488,7 @@ func TestEquationDup(t *testing.T) {
 				},
 			},
 			ckey: "A", mkey: "D",
-			want: &equation{
+			want: &nameEquation{
 				c: map[string]map[string]bool{
 					"B": {
 						"B": true,
@@ -500,7 +506,7 @@ func TestEquationDup(t *testing.T) {
 		},
 		// i=1
 		{
-			in: &equation{
+			in: &nameEquation{
 				c: map[string]map[string]bool{
 					"B": {
 						"B": true,
@@ -518,7 +524,7 @@ func TestEquationDup(t *testing.T) {
 				},
 			},
 			ckey: "B", mkey: "E",
-			want: &equation{
+			want: &nameEquation{
 				c: map[string]map[string]bool{
 					"C": {
 						"B": true,
@@ -534,20 +540,18 @@ func TestEquationDup(t *testing.T) {
 	}
 
 	for i, g := range golden {
-		got := g.in.dup()
-		if !reflect.DeepEqual(got, g.in) {
-			t.Errorf("i=%d: equation copy differs from original; expected %v, got %v", i, g.in, got)
+		eq := g.in.equation()
+		got := eq.dup()
+		if !reflect.DeepEqual(got.names(), g.in) {
+			t.Errorf("i=%d: equation copy differs from original; expected %v, got %v", i, g.in, got.names())
 			continue
 		}
-		delete(got.c, g.ckey)
-		delete(got.m, g.mkey)
-		if reflect.DeepEqual(got.c, g.in.c) {
-			t.Errorf("i=%d: copy refers to the same candidate node pair map as the original equation", i)
-		}
-		if reflect.DeepEqual(got.m, g.in.m) {
-			t.Errorf("i=%d: copy refers to the same known node pair map as the original equation", i)
+		got.c[got.si.id(g.ckey)] = nil
+		got.m[got.si.id(g.mkey)] = -1
+		if !reflect.DeepEqual(eq.names(), g.in) {
+			t.Errorf("i=%d: copy refers to the same node pairs as the original equation", i)
 		}
-		if !reflect.DeepEqual(got, g.want) {
+		if !reflect.DeepEqual(got.names(), g.want) {
 			t.Errorf("i=%d: unable to delete keys from equation copy", i)
 		}
 	}
@@ -555,14 +559,14 @@ func TestEquationDup(t *testing.T) {
 
 func TestEquationSolveUnique(t *testing.T) {
 	golden := []struct {
-		in   *equation
-		want *equation
+		in   *nameEquation
+		want *nameEquation
 		ok   bool
 		err  string
 	}{
 		// i=0
 		{
-			in: &equation{
+			in: &nameEquation{
 				c: map[string]map[string]bool{
 					"A": {
 						"A": true,
@@ -581,7 +585,7 @@ func TestEquationSolveUnique(t *testing.T) {
 					"E": "E",
 				},
 			},
-			want: &equation{
+			want: &nameEquation{
 				c: map[string]map[string]bool{
 					"B": {
 						"B": true,
@@ -603,7 +607,7 @@ func TestEquationSolveUnique(t *testing.T) {
 		},
 		// i=1
 		{
-			in: &equation{
+			in: &nameEquation{
 				c: map[string]map[string]bool{
 					"A": {
 						"A": true,
@@ -625,7 +629,7 @@ func TestEquationSolveUnique(t *testing.T) {
 				},
 				m: map[string]string{},
 			},
-			want: &equation{
+			want: &nameEquation{
 				c: map[string]map[string]bool{
 					"B": {
 						"B": true,
@@ -651,7 +655,7 @@ func TestEquationSolveUnique(t *testing.T) {
 		},
 		// i=2
 		{
-			in: &equation{
+			in: &nameEquation{
 				c: map[string]map[string]bool{
 					"B": {
 						"B": true,
@@ -672,7 +676,7 @@ func TestEquationSolveUnique(t *testing.T) {
 					"A": "A",
 				},
 			},
-			want: &equation{
+			want: &nameEquation{
 				c: map[string]map[string]bool{
 					"B": {
 						"B": true,
@@ -696,7 +700,7 @@ func TestEquationSolveUnique(t *testing.T) {
 		},
 		// i=3
 		{
-			in: &equation{
+			in: &nameEquation{
 				c: map[string]map[string]bool{
 					"B": {
 						"B": true,
@@ -715,7 +719,7 @@ func TestEquationSolveUnique(t *testing.T) {
 					"D": "D",
 				},
 			},
-			want: &equation{
+			want: &nameEquation{
 				c: map[string]map[string]bool{
 					"B": {
 						"B": true,
@@ -737,7 +741,7 @@ func TestEquationSolveUnique(t *testing.T) {
 		},
 		// i=4
 		{
-			in: &equation{
+			in: &nameEquation{
 				c: map[string]map[string]bool{
 					"B": {
 						"B": true,
@@ -754,7 +758,7 @@ func TestEquationSolveUnique(t *testing.T) {
 					"E": "E",
 				},
 			},
-			want: &equation{
+			want: &nameEquation{
 				c: map[string]map[string]bool{
 					"B": {
 						"B": true,
@@ -776,7 +780,7 @@ func TestEquationSolveUnique(t *testing.T) {
 		},
 		// i=5
 		{
-			in: &equation{
+			in: &nameEquation{
 				c: map[string]map[string]bool{
 					"B": {
 						"0": true,
@@ -799,7 +803,8 @@ func TestEquationSolveUnique(t *testing.T) {
 	}
 
 	for i, g := range golden {
-		ok, err := g.in.solveUnique()
+		eq := g.in.equation()
+		ok, err := eq.solveUnique()
 		if !sameError(err, g.err) {
 			t.Errorf("i=%d: error mismatch; expected %v, got %v", i, g.err, err)
 			continue
@@ -811,8 +816,74 @@ func TestEquationSolveUnique(t *testing.T) {
 			t.Errorf("i=%d: ok mismatch; expected %v, got %v", i, g.ok, ok)
 			continue
 		}
-		if !reflect.DeepEqual(g.in, g.want) {
-			t.Errorf("i=%d: node pair equation mismatch; expected %v, got %v", i, g.want, g.in)
+		if got := eq.names(); !reflect.DeepEqual(got, g.want) {
+			t.Errorf("i=%d: node pair equation mismatch; expected %v, got %v", i, g.want, got)
+		}
+	}
+}
+
+func TestEquationPropagate(t *testing.T) {
+	golden := []struct {
+		subPath   string
+		graphPath string
+		entry     string
+		want      map[string]string
+		stats     Stats
+		err       string
+	}{
+		// i=0
+		{
+			subPath:   "../testdata/primitives/pre_loop.dot",
+			graphPath: "../testdata/c4_graphs/stmt.dot",
+			entry:     "89",
+			want: map[string]string{
+				"A": "89",
+				"B": "92",
+				"C": "93",
+			},
+			stats: Stats{Arc: 1, AllDiff: 1},
+			err:   "",
+		},
+		// i=1
+		{
+			subPath:   "../testdata/primitives/if_else.dot",
+			graphPath: "../testdata/c4_graphs/stmt.dot",
+			entry:     "85",
+			want:      nil,
+			err:       "invalid mapping",
+		},
+	}
+
+	for i, g := range golden {
+		sub, err := graphs.ParseSubGraph(g.subPath)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		graph, err := dot.ParseFile(g.graphPath)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		eq, err := candidates(graph, g.entry, sub)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		eq.stats = &Stats{}
+		err = eq.propagate()
+		if !sameError(err, g.err) {
+			t.Errorf("i=%d: error mismatch; expected %v, got %v", i, g.err, err)
+			continue
+		} else if err != nil {
+			// Expected error, check next test case.
+			continue
+		}
+		if got := eq.mapping(); !reflect.DeepEqual(got, g.want) {
+			t.Errorf("i=%d: node pair map mismatch; expected %v, got %v", i, g.want, got)
+		}
+		if *eq.stats != g.stats {
+			t.Errorf("i=%d: statistics mismatch; expected %+v, got %+v", i, g.stats, *eq.stats)
 		}
 	}
 }
@@ -821,14 +892,14 @@ func TestEquationIsValid(t *testing.T) {
 	golden := []struct {
 		subPath   string
 		graphPath string
-		eq        *equation
+		eq        *nameEquation
 		want      bool
 	}{
 		// i=0
 		{
 			subPath:   "../testdata/primitives/if.dot",
 			graphPath: "../testdata/c4_graphs/stmt.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "71",
 					"B": "74",
@@ -841,7 +912,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/if.dot",
 			graphPath: "../testdata/c4_graphs/stmt.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "17",
 					"B": "24",
@@ -854,7 +925,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/if.dot",
 			graphPath: "../testdata/c4_graphs/stmt.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "89",
 					"B": "92",
@@ -867,7 +938,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/if.dot",
 			graphPath: "../testdata/c4_graphs/stmt.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "94",
 					"B": "97",
@@ -880,7 +951,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/if_else.dot",
 			graphPath: "../testdata/c4_graphs/expr.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "282",
 					"B": "292",
@@ -894,7 +965,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/if_else.dot",
 			graphPath: "../testdata/c4_graphs/expr.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "282",
 					"B": "287",
@@ -908,7 +979,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/if_else.dot",
 			graphPath: "../testdata/c4_graphs/next.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "438",
 					"B": "446",
@@ -922,7 +993,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/if_else.dot",
 			graphPath: "../testdata/c4_graphs/next.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "438",
 					"B": "443",
@@ -936,7 +1007,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/if_else.dot",
 			graphPath: "../testdata/c4_graphs/next.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "487",
 					"B": "492",
@@ -950,7 +1021,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/if_else.dot",
 			graphPath: "../testdata/c4_graphs/next.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "487",
 					"B": "495",
@@ -964,7 +1035,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/if_else.dot",
 			graphPath: "../testdata/c4_graphs/next.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "124",
 					"B": "134",
@@ -978,7 +1049,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/list.dot",
 			graphPath: "../testdata/c4_graphs/main.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "740",
 					"B": "760",
@@ -990,7 +1061,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/list.dot",
 			graphPath: "../testdata/c4_graphs/main.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "761",
 					"B": "762",
@@ -1002,7 +1073,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/pre_loop.dot",
 			graphPath: "../testdata/c4_graphs/expr.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "191",
 					"B": "194",
@@ -1015,7 +1086,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/pre_loop.dot",
 			graphPath: "../testdata/c4_graphs/expr.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "370",
 					"B": "378",
@@ -1028,7 +1099,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/pre_loop.dot",
 			graphPath: "../testdata/c4_graphs/expr.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "526",
 					"B": "530",
@@ -1041,7 +1112,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/if_else.dot",
 			graphPath: "../testdata/c4_graphs/expr.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "611",
 					"B": "615",
@@ -1055,7 +1126,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/if_else.dot",
 			graphPath: "../testdata/c4_graphs/expr.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "611",
 					"B": "615",
@@ -1068,7 +1139,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/if.dot",
 			graphPath: "../testdata/c4_graphs/main.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "20",
 					"B": "25",
@@ -1081,7 +1152,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/pre_loop.dot",
 			graphPath: "../testdata/c4_graphs/stmt.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "39", // 48
 					"B": "44",
@@ -1094,7 +1165,7 @@ func TestEquationIsValid(t *testing.T) {
 		{
 			subPath:   "../testdata/primitives/pre_loop.dot",
 			graphPath: "../testdata/c4_graphs/stmt.dot",
-			eq: &equation{
+			eq: &nameEquation{
 				m: map[string]string{
 					"A": "39",
 					"B": "44",
@@ -1116,7 +1187,11 @@ func TestEquationIsValid(t *testing.T) {
 			t.Errorf("i=%d: %v", i, err)
 			continue
 		}
-		got := g.eq.isValid(graph, sub)
+		eq := newEquation(newIndex(graph), newSubIndex(sub))
+		for sname, gname := range g.eq.m {
+			eq.m[eq.si.id(sname)] = eq.gi.id(gname)
+		}
+		got := eq.isValid(graph, sub)
 		if got != g.want {
 			t.Errorf("i=%d: ok mismatch; expected %v, got %v", i, g.want, got)
 			continue
@@ -1319,6 +1394,114 @@ func TestIsomorphism(t *testing.T) {
 		if !reflect.DeepEqual(m, g.m) {
 			t.Errorf("i=%d: node pair mapping mismatch; expected %v, got %v", i, g.m, m)
 		}
+		match, ok := Matcher{Engine: EngineVF2}.Isomorphism(graph, g.entry, sub)
+		if ok != g.ok {
+			t.Errorf("i=%d: VF2 ok mismatch; expected %v, got %v", i, g.ok, ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(match.Nodes, g.m) {
+			t.Errorf("i=%d: VF2 node pair mapping mismatch; expected %v, got %v", i, g.m, match.Nodes)
+		}
+	}
+}
+
+func TestMatcherIsomorphismLabels(t *testing.T) {
+	golden := []struct {
+		subPath   string
+		graphPath string
+		entry     string
+		match     *Match
+		ok        bool
+	}{
+		// i=0
+		{
+			subPath:   "../testdata/primitives/if.dot",
+			graphPath: "../testdata/c4_graphs/stmt.dot",
+			entry:     "71",
+			match: &Match{
+				Nodes: map[string]string{
+					"A": "71",
+					"B": "74",
+					"C": "75",
+				},
+			},
+			ok: true,
+		},
+		// i=1
+		{
+			subPath:   "../testdata/primitives/if.dot",
+			graphPath: "../testdata/c4_graphs/main.dot",
+			entry:     "289",
+			match: &Match{
+				Nodes: map[string]string{
+					"A": "289",
+					"B": "292",
+					"C": "295",
+				},
+				Inverted: map[string]bool{
+					"A": true,
+				},
+			},
+			ok: true,
+		},
+		// i=2
+		{
+			subPath:   "../testdata/primitives/if_else.dot",
+			graphPath: "../testdata/primitives/if_else.dot",
+			entry:     "A",
+			match: &Match{
+				Nodes: map[string]string{
+					"A": "A",
+					"B": "B",
+					"C": "C",
+					"D": "D",
+				},
+			},
+			ok: true,
+		},
+		// i=3
+		{
+			subPath:   "../testdata/primitives/if.dot",
+			graphPath: "../testdata/c4_graphs/stmt.dot",
+			entry:     "89",
+			match:     nil,
+			ok:        false,
+		},
+	}
+
+	matcher := Matcher{Labels: true}
+	for i, g := range golden {
+		sub, err := graphs.ParseSubGraph(g.subPath)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		graph, err := dot.ParseFile(g.graphPath)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		match, ok := matcher.Isomorphism(graph, g.entry, sub)
+		if ok != g.ok {
+			t.Errorf("i=%d: ok mismatch; expected %v, got %v", i, g.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if !reflect.DeepEqual(match.Nodes, g.match.Nodes) {
+			t.Errorf("i=%d: node pair mapping mismatch; expected %v, got %v", i, g.match.Nodes, match.Nodes)
+		}
+		if len(match.Inverted) != len(g.match.Inverted) {
+			t.Errorf("i=%d: inverted branch polarity mismatch; expected %v, got %v", i, g.match.Inverted, match.Inverted)
+			continue
+		}
+		for sname := range g.match.Inverted {
+			if !match.Inverted[sname] {
+				t.Errorf("i=%d: inverted branch polarity mismatch; expected %v, got %v", i, g.match.Inverted, match.Inverted)
+				break
+			}
+		}
 	}
 }
 
@@ -1520,7 +1703,1027 @@ func TestSearch(t *testing.T) {
 		if !reflect.DeepEqual(m, g.m) {
 			t.Errorf("i=%d: node pair mapping mismatch; expected %v, got %v", i, g.m, m)
 		}
+		match, ok := Matcher{Engine: EngineVF2}.Search(graph, sub)
+		if ok != g.ok {
+			t.Errorf("i=%d: VF2 ok mismatch; expected %v, got %v", i, g.ok, ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(match.Nodes, g.m) {
+			t.Errorf("i=%d: VF2 node pair mapping mismatch; expected %v, got %v", i, g.m, match.Nodes)
+		}
+	}
+}
+
+func TestEngines(t *testing.T) {
+	subPaths := []string{
+		"../testdata/primitives/if.dot",
+		"../testdata/primitives/if_else.dot",
+		"../testdata/primitives/if_return.dot",
+		"../testdata/primitives/list.dot",
+		"../testdata/primitives/post_loop.dot",
+		"../testdata/primitives/pre_loop.dot",
+	}
+	graphPaths := []string{
+		"../testdata/c4_graphs/expr.dot",
+		"../testdata/c4_graphs/main.dot",
+		"../testdata/c4_graphs/next.dot",
+		"../testdata/c4_graphs/stmt.dot",
+	}
+
+	for _, subPath := range subPaths {
+		sub, err := graphs.ParseSubGraph(subPath)
+		if err != nil {
+			t.Errorf("%s: %v", subPath, err)
+			continue
+		}
+		for _, graphPath := range graphPaths {
+			graph, err := dot.ParseFile(graphPath)
+			if err != nil {
+				t.Errorf("%s: %v", graphPath, err)
+				continue
+			}
+			for _, labels := range []bool{false, true} {
+				brute := Matcher{Labels: labels, All: true, Engine: EngineBrute}.SearchAll(graph, sub)
+				vf2 := Matcher{Labels: labels, All: true, Engine: EngineVF2}.SearchAll(graph, sub)
+				if !reflect.DeepEqual(brute, vf2) {
+					t.Errorf("%s in %s (labels=%v): engine mismatch; brute force located %v, VF2 located %v", subPath, graphPath, labels, mappings(brute), mappings(vf2))
+				}
+			}
+		}
+	}
+}
+
+func TestIsomorphismsAt(t *testing.T) {
+	golden := []struct {
+		subPath   string
+		graphPath string
+		entry     string
+		labels    bool
+		want      []*Match
+	}{
+		// i=0
+		{
+			subPath:   "../testdata/primitives/if_else.dot",
+			graphPath: "../testdata/primitives/if_else.dot",
+			entry:     "A",
+			want: []*Match{
+				{
+					Nodes: map[string]string{
+						"A": "A",
+						"B": "B",
+						"C": "C",
+						"D": "D",
+					},
+				},
+			},
+		},
+		// i=1
+		{
+			subPath:   "../testdata/primitives/if.dot",
+			graphPath: "../testdata/c4_graphs/stmt.dot",
+			entry:     "71",
+			want: []*Match{
+				{
+					Nodes: map[string]string{
+						"A": "71",
+						"B": "74",
+						"C": "75",
+					},
+				},
+			},
+		},
+		// i=2
+		{
+			subPath:   "../testdata/primitives/if.dot",
+			graphPath: "../testdata/c4_graphs/stmt.dot",
+			entry:     "89",
+			want:      nil,
+		},
+		// i=3
+		{
+			subPath:   "../testdata/primitives/if_else.dot",
+			graphPath: "../testdata/primitives/if_else.dot",
+			entry:     "A",
+			labels:    true,
+			want: []*Match{
+				{
+					Nodes: map[string]string{
+						"A": "A",
+						"B": "B",
+						"C": "C",
+						"D": "D",
+					},
+					Inverted: map[string]bool{},
+				},
+			},
+		},
+		// i=4
+		{
+			subPath:   "../testdata/primitives/if_else.dot",
+			graphPath: "../testdata/c4_graphs/expr.dot",
+			entry:     "282",
+			labels:    true,
+			want: []*Match{
+				{
+					Nodes: map[string]string{
+						"A": "282",
+						"B": "287",
+						"C": "292",
+						"D": "299",
+					},
+					Inverted: map[string]bool{},
+				},
+			},
+		},
+		// i=5
+		{
+			subPath:   "../testdata/primitives/if_else.dot",
+			graphPath: "../testdata/c4_graphs/expr.dot",
+			entry:     "282",
+			want: []*Match{
+				{
+					Nodes: map[string]string{
+						"A": "282",
+						"B": "287",
+						"C": "292",
+						"D": "299",
+					},
+				},
+			},
+		},
+	}
+
+	for i, g := range golden {
+		sub, err := graphs.ParseSubGraph(g.subPath)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		graph, err := dot.ParseFile(g.graphPath)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		got := Matcher{Labels: g.labels}.IsomorphismsAt(graph, g.entry, sub)
+		if !reflect.DeepEqual(got, g.want) {
+			t.Errorf("i=%d: matches mismatch; expected %v, got %v", i, g.want, got)
+		}
+		// The package-level function ignores edge labels.
+		if g.labels {
+			continue
+		}
+		if ms := IsomorphismsAt(graph, g.entry, sub); !reflect.DeepEqual(ms, mappings(g.want)) {
+			t.Errorf("i=%d: node pair mappings mismatch; expected %v, got %v", i, mappings(g.want), ms)
+		}
+	}
+}
+
+func TestMatcherIsomorphismsAtAll(t *testing.T) {
+	golden := []struct {
+		subPath   string
+		graphPath string
+		entry     string
+		want      []map[string]string
+	}{
+		// i=0
+		{
+			subPath:   "../testdata/primitives/if_else.dot",
+			graphPath: "../testdata/primitives/if_else.dot",
+			entry:     "A",
+			want: []map[string]string{
+				{
+					"A": "A",
+					"B": "B",
+					"C": "C",
+					"D": "D",
+				},
+				{
+					"A": "A",
+					"B": "C",
+					"C": "B",
+					"D": "D",
+				},
+			},
+		},
+		// i=1
+		{
+			subPath:   "../testdata/primitives/if_else.dot",
+			graphPath: "../testdata/c4_graphs/expr.dot",
+			entry:     "282",
+			want: []map[string]string{
+				{
+					"A": "282",
+					"B": "287",
+					"C": "292",
+					"D": "299",
+				},
+				{
+					"A": "282",
+					"B": "292",
+					"C": "287",
+					"D": "299",
+				},
+			},
+		},
+	}
+
+	matcher := Matcher{All: true}
+	for i, g := range golden {
+		sub, err := graphs.ParseSubGraph(g.subPath)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		graph, err := dot.ParseFile(g.graphPath)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		got := mappings(matcher.IsomorphismsAt(graph, g.entry, sub))
+		if !reflect.DeepEqual(got, g.want) {
+			t.Errorf("i=%d: node pair mappings mismatch; expected %v, got %v", i, g.want, got)
+		}
+	}
+}
+
+func TestAutomorphisms(t *testing.T) {
+	golden := []struct {
+		subPath string
+		labels  bool
+		want    []map[string]string
+	}{
+		// i=0
+		{
+			subPath: "../testdata/primitives/if_else.dot",
+			want: []map[string]string{
+				{
+					"A": "A",
+					"B": "B",
+					"C": "C",
+					"D": "D",
+				},
+				{
+					"A": "A",
+					"B": "C",
+					"C": "B",
+					"D": "D",
+				},
+			},
+		},
+		// i=1
+		{
+			subPath: "../testdata/primitives/if_else.dot",
+			labels:  true,
+			want: []map[string]string{
+				{
+					"A": "A",
+					"B": "B",
+					"C": "C",
+					"D": "D",
+				},
+				{
+					"A": "A",
+					"B": "C",
+					"C": "B",
+					"D": "D",
+				},
+			},
+		},
+		// i=2
+		{
+			subPath: "../testdata/primitives/pre_loop.dot",
+			want: []map[string]string{
+				{
+					"A": "A",
+					"B": "B",
+					"C": "C",
+				},
+			},
+		},
+	}
+
+	for i, g := range golden {
+		sub, err := graphs.ParseSubGraph(g.subPath)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		got := automorphisms(sub, g.labels)
+		if !reflect.DeepEqual(got, g.want) {
+			t.Errorf("i=%d: automorphisms mismatch; expected %v, got %v", i, g.want, got)
+		}
+	}
+}
+
+func TestSearchAll(t *testing.T) {
+	golden := []struct {
+		subPath   string
+		graphPath string
+		want      []map[string]string
+	}{
+		// i=0
+		{
+			subPath:   "../testdata/primitives/if.dot",
+			graphPath: "../testdata/c4_graphs/stmt.dot",
+			want: []map[string]string{
+				{
+					"A": "17",
+					"B": "24",
+					"C": "32",
+				},
+				{
+					"A": "71",
+					"B": "74",
+					"C": "75",
+				},
+			},
+		},
+		// i=1
+		{
+			subPath:   "../testdata/primitives/if_else.dot",
+			graphPath: "../testdata/c4_graphs/stmt.dot",
+			want:      nil,
+		},
+	}
+
+	for i, g := range golden {
+		sub, err := graphs.ParseSubGraph(g.subPath)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		graph, err := dot.ParseFile(g.graphPath)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		got := SearchAll(graph, sub)
+		if !reflect.DeepEqual(got, g.want) {
+			t.Errorf("i=%d: node pair mappings mismatch; expected %v, got %v", i, g.want, got)
+		}
+	}
+}
+
+func TestSearchContext(t *testing.T) {
+	subPaths := []string{
+		"../testdata/primitives/if.dot",
+		"../testdata/primitives/if_else.dot",
+		"../testdata/primitives/if_return.dot",
+		"../testdata/primitives/list.dot",
+		"../testdata/primitives/post_loop.dot",
+		"../testdata/primitives/pre_loop.dot",
+	}
+	graphPaths := []string{
+		"../testdata/c4_graphs/expr.dot",
+		"../testdata/c4_graphs/main.dot",
+		"../testdata/c4_graphs/next.dot",
+		"../testdata/c4_graphs/stmt.dot",
+	}
+
+	ctx := context.Background()
+	for _, subPath := range subPaths {
+		sub, err := graphs.ParseSubGraph(subPath)
+		if err != nil {
+			t.Errorf("%s: %v", subPath, err)
+			continue
+		}
+		for _, graphPath := range graphPaths {
+			graph, err := dot.ParseFile(graphPath)
+			if err != nil {
+				t.Errorf("%s: %v", graphPath, err)
+				continue
+			}
+			want := Matcher{}.SearchAll(graph, sub)
+			wantFirst, wantOK := Matcher{}.Search(graph, sub)
+			for _, workers := range []int{1, 3, 0} {
+				matcher := Matcher{Workers: workers}
+				got, err := matcher.SearchAllContext(ctx, graph, sub)
+				if err != nil {
+					t.Errorf("%s in %s (workers=%d): %v", subPath, graphPath, workers, err)
+					continue
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s in %s (workers=%d): isomorphisms mismatch; expected %v, got %v", subPath, graphPath, workers, mappings(want), mappings(got))
+				}
+				first, ok, err := matcher.SearchContext(ctx, graph, sub)
+				if err != nil {
+					t.Errorf("%s in %s (workers=%d): %v", subPath, graphPath, workers, err)
+					continue
+				}
+				if ok != wantOK || !reflect.DeepEqual(first, wantFirst) {
+					t.Errorf("%s in %s (workers=%d): first isomorphism mismatch; expected %v, got %v", subPath, graphPath, workers, wantFirst, first)
+				}
+			}
+		}
+	}
+
+	// Cancelled search.
+	sub, err := graphs.ParseSubGraph("../testdata/primitives/if.dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := dot.ParseFile("../testdata/c4_graphs/stmt.dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := (Matcher{}).SearchAllContext(cancelled, graph, sub); err != context.Canceled {
+		t.Errorf("cancelled search error mismatch; expected %v, got %v", context.Canceled, err)
+	}
+	if _, _, err := (Matcher{}).SearchContext(cancelled, graph, sub); err != context.Canceled {
+		t.Errorf("cancelled search error mismatch; expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	golden := []struct {
+		subPath   string
+		graphPath string
+		entry     string
+		matcher   Matcher
+		want      *Explanation
+	}{
+		// i=0
+		{
+			subPath:   "../testdata/primitives/if.dot",
+			graphPath: "../testdata/c4_graphs/stmt.dot",
+			entry:     "17",
+			want: &Explanation{
+				Entry:  "17",
+				Reason: ReasonNone,
+				Nodes:  map[string]string{"A": "17", "B": "24", "C": "32"},
+			},
+		},
+		// i=1
+		{
+			subPath:   "../testdata/primitives/if.dot",
+			graphPath: "../testdata/c4_graphs/stmt.dot",
+			entry:     "foo",
+			want: &Explanation{
+				Entry:  "foo",
+				Reason: ReasonMissingNode,
+				Sub:    "A",
+				Node:   "foo",
+			},
+		},
+		// i=2
+		{
+			subPath:   "../testdata/primitives/if.dot",
+			graphPath: "../testdata/c4_graphs/stmt.dot",
+			entry:     "0",
+			want: &Explanation{
+				Entry:  "0",
+				Reason: ReasonDegree,
+				Sub:    "B",
+				Nodes:  map[string]string{"A": "0"},
+			},
+		},
+		// i=3
+		{
+			subPath:   "../testdata/primitives/if.dot",
+			graphPath: "../testdata/c4_graphs/stmt.dot",
+			entry:     "85",
+			want: &Explanation{
+				Entry:  "85",
+				Reason: ReasonMissingEdge,
+				Sub:    "A",
+				Node:   "85",
+				Nodes:  map[string]string{"A": "85", "B": "88", "C": "89"},
+			},
+		},
+		// i=4
+		{
+			subPath:   "../testdata/primitives/if.dot",
+			graphPath: "../testdata/c4_graphs/stmt.dot",
+			entry:     "89",
+			want: &Explanation{
+				Entry:  "89",
+				Reason: ReasonDominance,
+				Sub:    "C",
+				Node:   "107",
+				Nodes:  map[string]string{"A": "89", "B": "93", "C": "107"},
+			},
+		},
+		// i=5
+		{
+			subPath:   "../testdata/primitives/if_else.dot",
+			graphPath: "../testdata/c4_graphs/stmt.dot",
+			entry:     "17",
+			want: &Explanation{
+				Entry:  "17",
+				Reason: ReasonDuplicate,
+				Sub:    "C",
+				Node:   "24",
+				Nodes:  map[string]string{"A": "17", "B": "24"},
+			},
+		},
+		// i=6
+		{
+			subPath:   "../testdata/primitives/list.dot",
+			graphPath: "../testdata/infinity_graphs/main.dot",
+			entry:     "1",
+			matcher:   Matcher{SESE: true},
+			want: &Explanation{
+				Entry:  "1",
+				Reason: ReasonPostDominance,
+				Sub:    "B",
+				Node:   "2",
+				Nodes:  map[string]string{"A": "1", "B": "2"},
+			},
+		},
+	}
+
+	for i, g := range golden {
+		sub, err := graphs.ParseSubGraph(g.subPath)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		graph, err := dot.ParseFile(g.graphPath)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		got := g.matcher.Explain(graph, g.entry, sub)
+		if !reflect.DeepEqual(got, g.want) {
+			t.Errorf("i=%d: explanation mismatch; expected %v %v, got %v %v", i, g.want, g.want.Nodes, got, got.Nodes)
+		}
+	}
+
+	// Every entry node with an isomorphism is explained as such.
+	sub, err := graphs.ParseSubGraph("../testdata/primitives/pre_loop.dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := dot.ParseFile("../testdata/c4_graphs/main.dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range (Matcher{}).ExplainAll(graph, sub) {
+		_, ok := Matcher{}.Isomorphism(graph, e.Entry, sub)
+		if ok != (e.Reason == ReasonNone) {
+			t.Errorf("entry node %q: explanation mismatch; isomorphism located %v, got %v", e.Entry, ok, e)
+		}
+		if !ok && e.Reason == ReasonUnknown {
+			t.Errorf("entry node %q: unknown failure reason", e.Entry)
+		}
+	}
+}
+
+func TestMatcherSESE(t *testing.T) {
+	golden := []struct {
+		subPath   string
+		graphPath string
+		entry     string
+		// Isomorphism located without and with the SESE requirement.
+		want, sese bool
+	}{
+		// i=0
+		{subPath: "../testdata/primitives/if.dot", graphPath: "../testdata/c4_graphs/stmt.dot", entry: "17", want: true, sese: true},
+		// i=1
+		{subPath: "../testdata/primitives/pre_loop.dot", graphPath: "../testdata/c4_graphs/stmt.dot", entry: "89", want: true, sese: true},
+		// i=2
+		{subPath: "../testdata/primitives/list.dot", graphPath: "../testdata/infinity_graphs/main.dot", entry: "1", want: true, sese: false},
+		// i=3
+		//
+		// Control flow leaves the region through the intermediate node "14",
+		// which returns; the exit node "13" is dominated by, but does not
+		// post-dominate, the entry node "10".
+		{subPath: "../testdata/primitives/if_return.dot", graphPath: "../testdata/c4_graphs/stmt.dot", entry: "10", want: true, sese: false},
+	}
+
+	for i, g := range golden {
+		sub, err := graphs.ParseSubGraph(g.subPath)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		graph, err := dot.ParseFile(g.graphPath)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		for _, engine := range []Engine{EngineBrute, EngineVF2} {
+			_, ok := Matcher{Engine: engine}.Isomorphism(graph, g.entry, sub)
+			if ok != g.want {
+				t.Errorf("i=%d engine=%d: isomorphism mismatch; expected %v, got %v", i, engine, g.want, ok)
+			}
+			_, ok = Matcher{Engine: engine, SESE: true}.Isomorphism(graph, g.entry, sub)
+			if ok != g.sese {
+				t.Errorf("i=%d engine=%d: SESE isomorphism mismatch; expected %v, got %v", i, engine, g.sese, ok)
+			}
+		}
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	// Subgraphs in order of priority.
+	subPaths := []string{
+		"../testdata/primitives/list.dot",
+		"../testdata/primitives/if.dot",
+		"../testdata/primitives/if_else.dot",
+		"../testdata/primitives/if_return.dot",
+		"../testdata/primitives/pre_loop.dot",
+		"../testdata/primitives/post_loop.dot",
+		"../testdata/primitives/inf_loop.dot",
+	}
+	graphPaths := []string{
+		"../testdata/c4_graphs/expr.dot",
+		"../testdata/c4_graphs/main.dot",
+		"../testdata/c4_graphs/next.dot",
+		"../testdata/c4_graphs/stmt.dot",
+		"../testdata/infinity_graphs/main.dot",
+		"../testdata/irreducible_graphs/nested.dot",
+	}
+	matchers := []Matcher{
+		{},
+		{Labels: true},
+		{SESE: true},
+		{Engine: EngineVF2, Labels: true, SESE: true},
+	}
+
+	var subs []*graphs.SubGraph
+	for _, subPath := range subPaths {
+		sub, err := graphs.ParseSubGraph(subPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs = append(subs, sub)
+	}
+	for _, graphPath := range graphPaths {
+		for i, matcher := range matchers {
+			graph, err := dot.ParseFile(graphPath)
+			if err != nil {
+				t.Errorf("%s: %v", graphPath, err)
+				continue
+			}
+			var incs []*Incremental
+			for _, sub := range subs {
+				incs = append(incs, matcher.NewIncremental(graph, sub))
+			}
+			// Repeatedly merge the isomorphism of the highest priority subgraph,
+			// and compare the incremental search against a full search.
+			for step := 0; ; step++ {
+				var (
+					sub   *graphs.SubGraph
+					match *Match
+				)
+				for j, s := range subs {
+					want, wantOK := matcher.Search(graph, s)
+					got, ok := incs[j].Search()
+					if ok != wantOK || !reflect.DeepEqual(got, want) {
+						t.Errorf("%s (matcher=%d, step=%d): isomorphism of %q mismatch; expected %v, got %v", graphPath, i, step, s.Name, want, got)
+					}
+					if wantOK {
+						sub, match = s, want
+						break
+					}
+				}
+				if match == nil {
+					break
+				}
+				name, err := merge.Merge(graph, match.Nodes, sub)
+				if err != nil {
+					t.Errorf("%s (matcher=%d, step=%d): %v", graphPath, i, step, err)
+					break
+				}
+				for _, inc := range incs {
+					inc.Merged(name)
+				}
+			}
+		}
+	}
+}
+
+func TestMatcherChain(t *testing.T) {
+	golden := []struct {
+		sub   string
+		graph string
+		entry string
+		want  map[string]string
+		// Chain of the repeat node "B".
+		chain []string
+	}{
+		// i=0
+		{
+			sub:   `digraph seq { A [label="entry"]; B [repeat="+"]; C [label="exit"]; A->B; B->C }`,
+			graph: `digraph g { a [label="entry"]; a->b; b->c; c->d; d->e; d->f; e->g; f->g }`,
+			entry: "a",
+			want:  map[string]string{"A": "a", "B": "b", "B.1": "c", "C": "d"},
+			chain: []string{"b", "c"},
+		},
+		// i=1
+		{
+			sub:   `digraph if { A [label="entry"]; B [repeat="+"]; C [label="exit"]; A->B [label="true"]; A->C [label="false"]; B->C }`,
+			graph: `digraph g { a [label="entry"]; a->b [label="true"]; a->e [label="false"]; b->c; c->d; d->e }`,
+			entry: "a",
+			want:  map[string]string{"A": "a", "B": "b", "B.1": "c", "B.2": "d", "C": "e"},
+			chain: []string{"b", "c", "d"},
+		},
+		// i=2
+		{
+			sub:   `digraph if { A [label="entry"]; B [repeat="+"]; C [label="exit"]; A->B [label="true"]; A->C [label="false"]; B->C }`,
+			graph: `digraph g { a [label="entry"]; a->b [label="true"]; a->d [label="false"]; b->d }`,
+			entry: "a",
+			want:  map[string]string{"A": "a", "B": "b", "C": "d"},
+			chain: []string{"b"},
+		},
+		// i=3
+		{
+			sub:   `digraph if { A [label="entry"]; B [repeat="+"]; C [label="exit"]; A->B [label="true"]; A->C [label="false"]; B->C }`,
+			graph: `digraph g { a [label="entry"]; a->b [label="true"]; a->d [label="false"]; b->c; b->d; c->d }`,
+			entry: "a",
+			want:  nil,
+		},
+		// i=4
+		{
+			sub:   `digraph loop { A [label="entry", repeat="+"]; B [label="exit"]; A->A; A->B }`,
+			graph: `digraph g { a [label="entry"]; a->b; b->c; c->a; c->d }`,
+			entry: "a",
+			want:  map[string]string{"A": "a", "A.1": "b", "A.2": "c", "B": "d"},
+		},
+	}
+
+	for i, g := range golden {
+		sg, err := dot.Read([]byte(g.sub))
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		sub, err := graphs.NewSubGraph(sg)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		graph, err := dot.Read([]byte(g.graph))
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		for _, engine := range []Engine{EngineBrute, EngineVF2} {
+			matcher := Matcher{Engine: engine, Labels: true}
+			match, ok := matcher.Isomorphism(graph, g.entry, sub)
+			if !ok {
+				if g.want != nil {
+					t.Errorf("i=%d engine=%d: unable to locate isomorphism; expected %v", i, engine, g.want)
+				}
+				continue
+			}
+			if !reflect.DeepEqual(match.Nodes, g.want) {
+				t.Errorf("i=%d engine=%d: mapping mismatch; expected %v, got %v", i, engine, g.want, match.Nodes)
+			}
+			if chain := match.Chain("B"); g.chain != nil && !reflect.DeepEqual(chain, g.chain) {
+				t.Errorf("i=%d engine=%d: chain mismatch; expected %v, got %v", i, engine, g.chain, chain)
+			}
+			// Isomorphisms with shorter chains overlap the preferred one.
+			if ms := matcher.IsomorphismsAt(graph, g.entry, sub); len(ms) != 1 || !reflect.DeepEqual(ms[0].Nodes, g.want) {
+				t.Errorf("i=%d engine=%d: isomorphisms mismatch; expected [%v], got %v", i, engine, g.want, mappings(ms))
+			}
+		}
+	}
+}
+
+func TestMatcherChainLong(t *testing.T) {
+	const src = `digraph if_else { A [label="entry"]; B [repeat="+"]; C [repeat="+"]; D [label="exit"]; A->B [label="true"]; A->C [label="false"]; B->D; C->D }`
+	sg, err := dot.Read([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := graphs.NewSubGraph(sg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Straight-line sequence of n nodes, preceded by an if-else statement with
+	// branches of n nodes each.
+	const n = 200
+	var buf strings.Builder
+	buf.WriteString(`digraph g { a [label="entry"]; a->b0 [label="true"]; a->c0 [label="false"]`)
+	for i := 1; i < n; i++ {
+		fmt.Fprintf(&buf, "; b%d->b%d; c%d->c%d; s%d->s%d", i-1, i, i-1, i, i-1, i)
+	}
+	fmt.Fprintf(&buf, "; b%d->s0; c%d->s0 }", n-1, n-1)
+	graph, err := dot.Read([]byte(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, engine := range []Engine{EngineBrute, EngineVF2} {
+		start := time.Now()
+		matcher := Matcher{Engine: engine, Labels: true}
+		ms := matcher.SearchAll(graph, sub)
+		if d := time.Since(start); d > 5*time.Second {
+			t.Errorf("engine=%d: search of %d nodes took %v", engine, len(graph.Nodes.Nodes), d)
+		}
+		if len(ms) != 1 {
+			t.Errorf("engine=%d: expected 1 isomorphism, got %d", engine, len(ms))
+			continue
+		}
+		if b, c := ms[0].Chain("B"), ms[0].Chain("C"); len(b) != n || len(c) != n || ms[0].Nodes["D"] != "s0" {
+			t.Errorf("engine=%d: expected chains of %d nodes followed by %q; got %d and %d nodes followed by %q", engine, n, "s0", len(b), len(c), ms[0].Nodes["D"])
+		}
+	}
+}
+
+func TestMatcherPredicates(t *testing.T) {
+	const graph = `digraph g { a [label="entry", kind="br"]; b [inst="call f; ret"]; c [kind="call"]; a->b [label="true"]; a->c [label="false"] }`
+	golden := []struct {
+		sub  string
+		want map[string]string
+		// Reason reported by Explain.
+		reason Reason
+	}{
+		// i=0
+		{
+			sub:  `digraph if_return { A [label="entry", eq_kind="br"]; B [re_inst="\\bret$"]; C [has_kind="true"]; A->B [label="true"]; A->C [label="false"] }`,
+			want: map[string]string{"A": "a", "B": "b", "C": "c"},
+		},
+		// i=1
+		{
+			sub:    `digraph if_return { A [label="entry", eq_kind="call"]; B; C; A->B [label="true"]; A->C [label="false"] }`,
+			reason: ReasonAttribute,
+		},
+		// i=2
+		{
+			sub:    `digraph if_return { A [label="entry"]; B [has_kind="false"]; C [re_inst="^jmp"]; A->B [label="true"]; A->C [label="false"] }`,
+			reason: ReasonAttribute,
+		},
+		// i=3
+		{
+			sub:  `digraph if_return { A [label="entry", has_kind="true"]; B [has_kind="false"]; C [eq_kind="call"]; A->B; A->C }`,
+			want: map[string]string{"A": "a", "B": "b", "C": "c"},
+		},
+		// i=4
+		{
+			sub:  `digraph if_return { A [label="entry"]; B [eq_kind="call"]; C [has_kind="false"]; A->B; A->C }`,
+			want: map[string]string{"A": "a", "B": "c", "C": "b"},
+		},
+	}
+
+	g, err := dot.Read([]byte(graph))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, gold := range golden {
+		sg, err := dot.Read([]byte(gold.sub))
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		sub, err := graphs.NewSubGraph(sg)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		for _, engine := range []Engine{EngineBrute, EngineVF2} {
+			matcher := Matcher{Engine: engine}
+			match, ok := matcher.Isomorphism(g, "a", sub)
+			var got map[string]string
+			if ok {
+				got = match.Nodes
+			}
+			if !reflect.DeepEqual(got, gold.want) {
+				t.Errorf("i=%d engine=%d: mapping mismatch; expected %v, got %v", i, engine, gold.want, got)
+			}
+			// Sub nodes with different predicates are not interchangeable.
+			if n := len(matcher.IsomorphismsAt(g, "a", sub)); ok && n != 1 {
+				t.Errorf("i=%d engine=%d: isomorphism count mismatch; expected 1, got %d", i, engine, n)
+			}
+		}
+		if gold.want == nil {
+			if e := (Matcher{}).Explain(g, "a", sub); e.Reason != gold.reason {
+				t.Errorf("i=%d: reason mismatch; expected %v, got %v", i, gold.reason, e.Reason)
+			}
+		}
+	}
+}
+
+func TestMatcherNoExit(t *testing.T) {
+	// The outgoing edges of every node of a subgraph without an exit node are
+	// considered; i.e. control flow may not leave the isomorphism. Incoming edges
+	// of the entry node are ignored.
+	const sub = `digraph inf_loop { A [role="entry"]; B; A->B; B->A }`
+	golden := []struct {
+		graph string
+		want  map[string]string
+		// Reason reported by Explain.
+		reason Reason
+	}{
+		// i=0
+		{
+			graph: `digraph g { a; b; c; a->b; b->c; c->b }`,
+			want:  map[string]string{"A": "b", "B": "c"},
+		},
+		// i=1
+		{
+			graph:  `digraph g { a; b; c; d; a->b; b->c; c->b; c->d }`,
+			reason: ReasonDegree,
+		},
+		// i=2
+		{
+			graph:  `digraph g { a; b; c; d; a->b; b->c; c->b; b->d }`,
+			reason: ReasonDegree,
+		},
+	}
+
+	sg, err := dot.Read([]byte(sub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := graphs.NewSubGraph(sg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, gold := range golden {
+		g, err := dot.Read([]byte(gold.graph))
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		for _, engine := range []Engine{EngineBrute, EngineVF2} {
+			match, ok := Matcher{Engine: engine}.Isomorphism(g, "b", s)
+			var got map[string]string
+			if ok {
+				got = match.Nodes
+			}
+			if !reflect.DeepEqual(got, gold.want) {
+				t.Errorf("i=%d engine=%d: mapping mismatch; expected %v, got %v", i, engine, gold.want, got)
+			}
+		}
+		if gold.want == nil {
+			if e := (Matcher{}).Explain(g, "b", s); e.Reason != gold.reason {
+				t.Errorf("i=%d: reason mismatch; expected %v, got %v", i, gold.reason, e.Reason)
+			}
+		}
+	}
+}
+
+// nameEquation is a node name representation of a node pair equation, used to
+// specify test cases.
+type nameEquation struct {
+	// mapping from sub node name to graph node name candidates.
+	c map[string]map[string]bool
+	// mapping from sub node name to graph node name.
+	m map[string]string
+}
+
+// equation returns the node pair equation of ne. The compact graph
+// representations of the equation contain the sub and graph node names of ne
+// without any edges.
+func (ne *nameEquation) equation() *equation {
+	snames := make(map[string]bool)
+	gnames := make(map[string]bool)
+	for sname, candidates := range ne.c {
+		snames[sname] = true
+		for gname := range candidates {
+			gnames[gname] = true
+		}
+	}
+	for sname, gname := range ne.m {
+		snames[sname] = true
+		gnames[gname] = true
+	}
+	gi := nameIndex(gnames)
+	si := &subIndex{index: nameIndex(snames), entry: -1, exit: -1}
+	eq := newEquation(gi, si)
+	for sname, candidates := range ne.c {
+		s := si.id(sname)
+		eq.c[s] = newBitset(gi.len())
+		for gname := range candidates {
+			eq.c[s].set(gi.id(gname))
+		}
+	}
+	for sname, gname := range ne.m {
+		eq.m[si.id(sname)] = gi.id(gname)
+	}
+	return eq
+}
+
+// nameIndex returns a compact graph representation of the given node names
+// without any edges.
+func nameIndex(names map[string]bool) *index {
+	graph := &dot.Graph{Nodes: &dot.Nodes{Lookup: make(map[string]*dot.Node)}}
+	for name := range names {
+		graph.Nodes.Lookup[name] = &dot.Node{Name: name}
+	}
+	return newIndex(graph)
+}
+
+// names returns the node name representation of eq.
+func (eq *equation) names() *nameEquation {
+	ne := &nameEquation{
+		c: make(map[string]map[string]bool),
+		m: eq.mapping(),
+	}
+	for s, candidates := range eq.c {
+		if candidates == nil {
+			continue
+		}
+		ne.c[eq.si.names[s]] = make(map[string]bool)
+		for _, g := range candidates.ids() {
+			ne.c[eq.si.names[s]][eq.gi.names[g]] = true
+		}
 	}
+	return ne
 }
 
 // sameError returns true if err is represented by the string s, and false
@@ -0,0 +1,129 @@
+package iso
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"decomp.org/x/graphs"
+	"github.com/mewfork/dot"
+)
+
+// SearchContext tries to locate an isomorphism of sub in graph, searching the
+// entry nodes concurrently. If successful it returns the isomorphism with the
+// first entry node in sorted order, which is the same isomorphism located by
+// Search. The boolean value is true if such an isomorphism could be located,
+// and false otherwise.
+//
+// The search is aborted with the error of ctx if ctx is cancelled before the
+// search completes. Cancellation is checked before each entry node is tried.
+func (matcher Matcher) SearchContext(ctx context.Context, graph *dot.Graph, sub *graphs.SubGraph) (match *Match, ok bool, err error) {
+	srch := matcher.newSearch(graph, sub)
+	results := make([]*Match, len(srch.gi.names))
+	var mu sync.Mutex
+	best := len(results)
+	err = srch.parallel(ctx, func(w *search, i int) {
+		// Skip entry nodes succeeding an entry node with an isomorphism.
+		mu.Lock()
+		skip := i > best
+		mu.Unlock()
+		if skip {
+			return
+		}
+		m, found := w.isomorphism(w.gi.names[i])
+		if !found {
+			return
+		}
+		results[i] = m
+		mu.Lock()
+		if i < best {
+			best = i
+		}
+		mu.Unlock()
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	for _, m := range results {
+		if m != nil {
+			return m, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// SearchAllContext returns every isomorphism of sub in graph, ordered by entry
+// node name, searching the entry nodes concurrently. The isomorphisms are the
+// same as those located by SearchAll.
+//
+// The search is aborted with the error of ctx if ctx is cancelled before the
+// search completes. Cancellation is checked before each entry node is tried.
+func (matcher Matcher) SearchAllContext(ctx context.Context, graph *dot.Graph, sub *graphs.SubGraph) ([]*Match, error) {
+	srch := matcher.newSearch(graph, sub)
+	results := make([][]*Match, len(srch.gi.names))
+	err := srch.parallel(ctx, func(w *search, i int) {
+		results[i] = w.isomorphismsAt(w.gi.names[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+	var matches []*Match
+	for _, ms := range results {
+		matches = append(matches, ms...)
+	}
+	return matches, nil
+}
+
+// parallel invokes f for the index of each entry node of the search, using a
+// pool of workers. The entry nodes are handed out in sorted order. Each worker
+// is given its own copy of the search, which shares the compact graph
+// representations but accumulates statistics separately; the statistics are
+// merged once all workers have finished.
+func (srch *search) parallel(ctx context.Context, f func(w *search, i int)) error {
+	n := srch.matcher.Workers
+	if n < 1 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	jobs := make(chan int)
+	workers := make([]*search, n)
+	var wg sync.WaitGroup
+	for i := range workers {
+		w := *srch
+		if srch.matcher.Stats != nil {
+			w.matcher.Stats = &Stats{}
+		}
+		workers[i] = &w
+		wg.Add(1)
+		go func(w *search) {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				f(w, i)
+			}
+		}(&w)
+	}
+
+	// Hand out the entry nodes in sorted order.
+loop:
+	for i := range srch.gi.names {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Merge statistics.
+	if stats := srch.matcher.Stats; stats != nil {
+		for _, w := range workers {
+			stats.Unique += w.matcher.Stats.Unique
+			stats.Arc += w.matcher.Stats.Arc
+			stats.AllDiff += w.matcher.Stats.AllDiff
+		}
+	}
+	return ctx.Err()
+}
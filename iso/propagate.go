@@ -0,0 +1,229 @@
+package iso
+
+import (
+	"github.com/mewkiz/pkg/errutil"
+)
+
+// Stats records the number of node pair candidates eliminated by each phase of
+// the constraint propagation.
+type Stats struct {
+	// Number of candidates eliminated by unique node pair assignments.
+	Unique int
+	// Number of candidates eliminated by arc consistency over the successor and
+	// predecessor adjacency of sub.
+	Arc int
+	// Number of candidates eliminated by all-different pruning.
+	AllDiff int
+}
+
+// propagate narrows the node pair candidates of eq until a fixed point is
+// reached, by repeatedly assigning unique node pairs, enforcing arc consistency
+// and pruning candidates violating the all-different constraint. An error is
+// returned if the equation has no solution.
+func (eq *equation) propagate() error {
+	for {
+		before := eq.size()
+
+		// Assign unique node pairs.
+		for {
+			n := eq.size()
+			ok, err := eq.solveUnique()
+			if err != nil {
+				return errutil.Err(err)
+			}
+			if !ok {
+				break
+			}
+			// The unique candidate moved to m is not counted as eliminated.
+			if eq.stats != nil {
+				eq.stats.Unique += n - eq.size() - 1
+			}
+		}
+
+		// Enforce arc consistency.
+		n := eq.size()
+		if err := eq.arcConsistency(); err != nil {
+			return errutil.Err(err)
+		}
+		if eq.stats != nil {
+			eq.stats.Arc += n - eq.size()
+		}
+
+		// Prune candidates violating the all-different constraint.
+		n = eq.size()
+		if err := eq.allDifferent(); err != nil {
+			return errutil.Err(err)
+		}
+		if eq.stats != nil {
+			eq.stats.AllDiff += n - eq.size()
+		}
+
+		if eq.size() == before {
+			return nil
+		}
+	}
+}
+
+// size returns the total number of node pair candidates in c.
+func (eq *equation) size() int {
+	n := 0
+	for _, candidates := range eq.c {
+		if candidates != nil {
+			n += candidates.count()
+		}
+	}
+	return n
+}
+
+// arc represents a constraint between the sub nodes x and y. When succ is
+// true, the sub node y is a successor of x; otherwise y is a predecessor of x.
+type arc struct {
+	x, y int
+	succ bool
+}
+
+// arcConsistency removes node pair candidates of c which have no support in
+// the candidates, or known node pair, of an adjacent sub node. Every sub edge
+// from s to t requires a graph edge from the graph node of s to the graph node
+// of t, except for edges from exit to entry which are ignored.
+func (eq *equation) arcConsistency() error {
+	// Initialize the work list with the arcs of each sub node with candidates.
+	// Sub node IDs are assigned in sorted node name order, which makes the
+	// algorithm deterministic.
+	var queue []arc
+	for s, candidates := range eq.c {
+		if candidates != nil {
+			queue = append(queue, eq.si.arcs(s)...)
+		}
+	}
+
+	for len(queue) > 0 {
+		a := queue[0]
+		queue = queue[1:]
+		candidates := eq.c[a.x]
+		if candidates == nil {
+			// Known node pair.
+			continue
+		}
+		changed := false
+		for _, g := range candidates.ids() {
+			if !eq.isSupported(g, a) {
+				candidates.clear(g)
+				changed = true
+			}
+		}
+		if candidates.count() == 0 {
+			eq.fail(ReasonMissingEdge, a.x, -1)
+			return errutil.Newf("invalid mapping; sub node %q has no candidates", eq.si.names[a.x])
+		}
+		if changed {
+			// Revisit the arcs of sub nodes adjacent to x.
+			for _, b := range eq.si.arcs(a.x) {
+				queue = append(queue, arc{x: b.y, y: b.x, succ: !b.succ})
+			}
+		}
+	}
+	return nil
+}
+
+// arcs returns the arcs from the sub node s to its successors and
+// predecessors, excluding edges from exit to entry.
+func (si *subIndex) arcs(s int) []arc {
+	var as []arc
+	for _, succ := range si.succs[s] {
+		if s == si.exit && succ == si.entry {
+			continue
+		}
+		as = append(as, arc{x: s, y: succ, succ: true})
+	}
+	for _, pred := range si.preds[s] {
+		if pred == si.exit && s == si.entry {
+			continue
+		}
+		as = append(as, arc{x: s, y: pred, succ: false})
+	}
+	return as
+}
+
+// isSupported returns true if the graph node g, as a candidate of the sub node
+// a.x, is adjacent to a candidate or the known graph node of the sub node a.y,
+// and false otherwise.
+func (eq *equation) isSupported(g int, a arc) bool {
+	adj := eq.gi.preds[g]
+	if a.succ {
+		adj = eq.gi.succs[g]
+	}
+	for _, h := range adj {
+		if known := eq.m[a.y]; known != -1 {
+			if h == known {
+				return true
+			}
+			continue
+		}
+		if eq.c[a.y] != nil && eq.c[a.y].has(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// allDifferent prunes node pair candidates violating the constraint that every
+// sub node maps to a distinct graph node. If the candidates of k sub nodes are
+// identical and of size k, those graph nodes are removed from the candidates
+// of every other sub node.
+func (eq *equation) allDifferent() error {
+	// Group sub nodes by their set of candidates. Sub node IDs are assigned in
+	// sorted node name order, which makes the algorithm deterministic.
+	var keys []string
+	groups := make(map[string][]int)
+	union := newBitset(eq.gi.len())
+	nsub := 0
+	for s, candidates := range eq.c {
+		if candidates == nil {
+			continue
+		}
+		nsub++
+		for i, w := range candidates {
+			union[i] |= w
+		}
+		key := candidates.key()
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], s)
+	}
+	if n := union.count(); n < nsub {
+		eq.fail(ReasonDuplicate, -1, -1)
+		return errutil.Newf("invalid mapping; %d sub nodes share %d graph node candidates", nsub, n)
+	}
+
+	for _, key := range keys {
+		ss := groups[key]
+		candidates := eq.c[ss[0]]
+		n := candidates.count()
+		if len(ss) > n {
+			eq.fail(ReasonDuplicate, ss[n], -1)
+			return errutil.Newf("invalid mapping; %d sub nodes share %d graph node candidates", len(ss), n)
+		}
+		if len(ss) < n {
+			continue
+		}
+		member := make(map[int]bool, len(ss))
+		for _, s := range ss {
+			member[s] = true
+		}
+		for s, other := range eq.c {
+			if other == nil || member[s] {
+				continue
+			}
+			for i, w := range candidates {
+				other[i] &^= w
+			}
+			if other.count() == 0 {
+				eq.fail(ReasonDuplicate, s, -1)
+				return errutil.Newf("invalid mapping; sub node %q has no candidates", eq.si.names[s])
+			}
+		}
+	}
+	return nil
+}
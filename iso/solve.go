@@ -1,85 +1,79 @@
 package iso
 
 import (
-	"fmt"
-	"sort"
-
 	"github.com/mewkiz/pkg/errutil"
 )
 
 // setPair marks the given node pair as known by removing it from c and storing
-// it in m. As the graph node name is no longer a valid candidate it is removed
-// from all other node pairs in c.
-func (eq *equation) setPair(sname, gname string) error {
+// it in m. As the graph node is no longer a valid candidate it is removed from
+// all other node pairs in c.
+func (eq *equation) setPair(s, g int) error {
 	// Sanity check.
-	if key, ok := findKey(eq.m, gname); ok {
-		return errutil.Newf("invalid mapping; sub node %q and %q both map to graph node %q", key, sname, gname)
+	if key, ok := eq.findKey(g); ok {
+		eq.fail(ReasonDuplicate, s, g)
+		return errutil.Newf("invalid mapping; sub node %q and %q both map to graph node %q", eq.si.names[key], eq.si.names[s], eq.gi.names[g])
 	}
 
 	// Move unique node pair from c to m.
-	eq.m[sname] = gname
-	delete(eq.c, sname)
+	eq.m[s] = g
+	eq.c[s] = nil
 
-	// Remove graph node name of the unique node pair from all other node
-	// pairs in c.
+	// Remove graph node of the unique node pair from all other node pairs in
+	// c.
 	for key, candidates := range eq.c {
-		delete(candidates, gname)
-		if len(eq.c[key]) == 0 {
-			return errutil.Newf("invalid mapping; sub node %q has no candidates", key)
+		if candidates == nil {
+			continue
+		}
+		candidates.clear(g)
+		if candidates.count() == 0 {
+			eq.fail(ReasonDuplicate, key, g)
+			return errutil.Newf("invalid mapping; sub node %q has no candidates", eq.si.names[key])
 		}
 	}
 
 	return nil
 }
 
-// findKey returns the first key in m which maps to the value val. The boolean
-// value is true if such a key could be located, and false otherwise.
-func findKey(m map[string]string, val string) (key string, ok bool) {
-	for key, x := range m {
-		if x == val {
-			return key, true
+// findKey returns the first sub node in m which maps to the graph node g. The
+// boolean value is true if such a sub node could be located, and false
+// otherwise.
+func (eq *equation) findKey(g int) (s int, ok bool) {
+	for s, x := range eq.m {
+		if x == g {
+			return s, true
 		}
 	}
-	return "", false
+	return -1, false
 }
 
 // dup returns a copy of eq.
 func (eq *equation) dup() *equation {
 	// Duplicate node pair candidates.
-	c := make(map[string]map[string]bool)
-	for sname, candidates := range eq.c {
-		c[sname] = make(map[string]bool)
-		for gname, val := range candidates {
-			c[sname][gname] = val
+	c := make([]bitset, len(eq.c))
+	for s, candidates := range eq.c {
+		if candidates != nil {
+			c[s] = make(bitset, len(candidates))
+			copy(c[s], candidates)
 		}
 	}
 
 	// Duplicate node pairs.
-	m := make(map[string]string)
-	for sname, gname := range eq.m {
-		m[sname] = gname
-	}
+	m := make([]int, len(eq.m))
+	copy(m, eq.m)
 
-	return &equation{c: c, m: m}
+	return &equation{gi: eq.gi, si: eq.si, c: c, m: m, labels: eq.labels, stats: eq.stats, diag: eq.diag}
 }
 
 // solveUnique tries to locate a unique node pair in c. If successful the node
-// pair is removed from c and stored in m. As the graph node name of the node
-// pair is no longer a valid candidate it is removed from all other node pairs
-// in c.
+// pair is removed from c and stored in m. As the graph node of the node pair is
+// no longer a valid candidate it is removed from all other node pairs in c.
 func (eq *equation) solveUnique() (ok bool, err error) {
-	// Sort keys to make the algorithm deterministic.
-	var snames []string
-	for sname := range eq.c {
-		snames = append(snames, sname)
-	}
-	sort.Strings(snames)
-
-	for _, sname := range snames {
-		candidates := eq.c[sname]
-		if len(candidates) == 1 {
-			gname := firstKey(candidates)
-			err := eq.setPair(sname, gname)
+	// Sub node IDs are assigned in sorted node name order, which makes the
+	// algorithm deterministic.
+	for s, candidates := range eq.c {
+		if candidates != nil && candidates.count() == 1 {
+			g := candidates.ids()[0]
+			err := eq.setPair(s, g)
 			if err != nil {
 				return false, errutil.Err(err)
 			}
@@ -90,13 +84,14 @@ func (eq *equation) solveUnique() (ok bool, err error) {
 	return false, nil
 }
 
-// firstKey returns the only key in m.
-func firstKey(m map[string]bool) string {
-	if len(m) != 1 {
-		panic(fmt.Sprintf("invalid map length; expected 1, got %d", len(m)))
-	}
-	for key := range m {
-		return key
+// mapping returns the mapping from sub node name to graph node name of the
+// known node pairs in eq.
+func (eq *equation) mapping() map[string]string {
+	m := make(map[string]string)
+	for s, g := range eq.m {
+		if g != -1 {
+			m[eq.si.names[s]] = eq.gi.names[g]
+		}
 	}
-	panic("unreachable")
+	return m
 }
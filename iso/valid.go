@@ -1,108 +1,152 @@
 package iso
 
 import (
-	"fmt"
-	"sort"
-
 	"decomp.org/x/graphs"
 	"github.com/mewfork/dot"
 )
 
-// isValid returns true if m is a valid mapping, from sub node name to graph
-// node name, for an isomorphism of sub in graph considering all nodes and edges
-// except predecessors of entry and successors of exit.
+// isValid returns true if m is a valid mapping, from sub node to graph node,
+// for an isomorphism of sub in graph considering all nodes and edges except
+// predecessors of entry and successors of exit.
 func (eq *equation) isValid(graph *dot.Graph, sub *graphs.SubGraph) bool {
-	if len(eq.m) != len(sub.Nodes.Nodes) {
-		return false
+	gi, si := eq.gi, eq.si
+	for _, g := range eq.m {
+		if g == -1 {
+			return false
+		}
 	}
 
 	// Check for duplicate values.
-	if hasDup(eq.m) {
+	if s, ok := eq.findDup(); ok {
+		eq.fail(ReasonDuplicate, s, eq.m[s])
 		return false
 	}
 
 	// Verify that the entry node dominates the exit node.
-	entry, ok := graph.Nodes.Lookup[eq.m[sub.Entry()]]
-	if !ok {
-		return false
-	}
-	exit, ok := graph.Nodes.Lookup[eq.m[sub.Exit()]]
-	if !ok {
+	if si.exit != -1 && !gi.dominates(graph, eq.m[si.entry], eq.m[si.exit]) {
+		eq.fail(ReasonDominance, si.exit, eq.m[si.exit])
 		return false
 	}
-	if !entry.Dominates(exit) {
+	if si.exit != -1 && !gi.isSESE(eq.m[si.entry], eq.m[si.exit]) {
+		eq.fail(ReasonPostDominance, si.exit, eq.m[si.exit])
 		return false
 	}
 
-	// Sort keys to make the algorithm deterministic.
-	var snames []string
-	for sname := range eq.m {
-		snames = append(snames, sname)
-	}
-	sort.Strings(snames)
-
-	for _, sname := range snames {
-		gname := eq.m[sname]
-		s, ok := sub.Nodes.Lookup[sname]
-		if !ok {
-			panic(fmt.Sprintf("unable to locate node %q in sub", sname))
-		}
-		g, ok := graph.Nodes.Lookup[gname]
-		if !ok {
-			panic(fmt.Sprintf("unable to locate node %q in graph", gname))
-		}
-
+	// Sub node IDs are assigned in sorted node name order, which makes the
+	// algorithm deterministic.
+	for s, g := range eq.m {
 		// Verify predecessors.
-		if s.Name != sub.Entry() {
-			if len(s.Preds) != len(g.Preds) {
+		if s != si.entry {
+			if len(si.preds[s]) != len(gi.preds[g]) {
+				eq.fail(ReasonDegree, s, g)
 				return false
 			}
-			for _, spred := range s.Preds {
-				found := false
-				for _, gpred := range g.Preds {
-					if gpred.Name == eq.m[spred.Name] {
-						found = true
-						break
-					}
-				}
-				if !found {
+			for _, spred := range si.preds[s] {
+				if !gi.hasEdge(eq.m[spred], g) {
+					eq.fail(ReasonMissingEdge, s, g)
 					return false
 				}
 			}
 		}
 
 		// Verify successors.
-		if s.Name != sub.Exit() {
-			if len(s.Succs) != len(g.Succs) {
+		if s != si.exit {
+			if len(si.succs[s]) != len(gi.succs[g]) {
+				eq.fail(ReasonDegree, s, g)
 				return false
 			}
-			for _, ssucc := range s.Succs {
-				found := false
-				for _, gsucc := range g.Succs {
-					if gsucc.Name == eq.m[ssucc.Name] {
-						found = true
-						break
-					}
-				}
-				if !found {
+			for _, ssucc := range si.succs[s] {
+				if !gi.hasEdge(g, eq.m[ssucc]) {
+					eq.fail(ReasonMissingEdge, s, g)
 					return false
 				}
 			}
 		}
 	}
 
+	// Verify edge labels.
+	if eq.labels != labelsIgnore {
+		for s := range eq.m {
+			if s == si.exit {
+				continue
+			}
+			exact, inverted := nodePolarity(gi, si, eq.m, s)
+			if !exact && (!inverted || eq.labels == labelsExact) {
+				eq.fail(ReasonLabel, s, eq.m[s])
+				return false
+			}
+		}
+	}
+
 	// Isomorphism found!
 	return true
 }
 
-// hasDup returns true if m contains a duplicate value.
-func hasDup(m map[string]string) bool {
-	vals := make(map[string]bool, len(m))
-	for _, v := range m {
-		if vals[v] {
-			return true
+// findDup returns the first sub node in m which maps to the same graph node as
+// a preceding sub node. The boolean value is true if m contains such a
+// duplicate value, and false otherwise.
+func (eq *equation) findDup() (s int, ok bool) {
+	vals := newBitset(eq.gi.len())
+	for s, g := range eq.m {
+		if vals.has(g) {
+			return s, true
+		}
+		vals.set(g)
+	}
+	return -1, false
+}
+
+// polarity compares the labels of the outgoing edges of each sub node, except
+// exit, with the labels of the corresponding edges in graph under the mapping
+// m from sub node ID to graph node ID. It returns the set of sub node names
+// with an inverted branch polarity; i.e. those whose "true" and "false" labels
+// are swapped in graph. The boolean value is true if the labels of every node
+// match, either directly or inverted, and false otherwise.
+func polarity(gi *index, si *subIndex, m []int) (inv map[string]bool, ok bool) {
+	inv = make(map[string]bool)
+	for s := range m {
+		if s == si.exit {
+			continue
 		}
-		vals[v] = true
+		exact, inverted := nodePolarity(gi, si, m, s)
+		switch {
+		case exact:
+		case inverted:
+			inv[si.names[s]] = true
+		default:
+			return nil, false
+		}
+	}
+	return inv, true
+}
+
+// nodePolarity compares the labels of the outgoing edges of the sub node s with
+// the labels of the corresponding edges in graph under the mapping m from sub
+// node ID to graph node ID. The boolean value exact is true if every label
+// matches directly, and inverted is true if every label matches once inverted.
+func nodePolarity(gi *index, si *subIndex, m []int, s int) (exact, inverted bool) {
+	exact, inverted = true, true
+	for _, ssucc := range si.succs[s] {
+		slabel := si.label(s, ssucc)
+		glabel := gi.label(m[s], m[ssucc])
+		if slabel != glabel {
+			exact = false
+		}
+		if slabel != invertLabel(glabel) {
+			inverted = false
+		}
+	}
+	return exact, inverted
+}
+
+// invertLabel returns the inverse of the branch condition label; i.e. "true"
+// for "false" and vice versa. Other labels are returned unchanged.
+func invertLabel(label string) string {
+	switch label {
+	case "true":
+		return "false"
+	case "false":
+		return "true"
 	}
-	return false
+	return label
 }
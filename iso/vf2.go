@@ -0,0 +1,209 @@
+package iso
+
+import (
+	"github.com/mewfork/dot"
+	"github.com/mewkiz/pkg/errutil"
+)
+
+// state represents the state of a VF2 search for isomorphisms of sub in graph
+// which start at a given entry node. In contrast to the node pair equation, the
+// state is extended and restored in place while backtracking, without copying
+// any candidate sets.
+//
+// The VF2 matching rules are adapted to the entry and exit semantics of
+// graphs.SubGraph; i.e. the predecessors of entry and the successors of exit
+// are ignored.
+type state struct {
+	graph *dot.Graph
+	// compact representation of graph.
+	gi *index
+	// compact representation of sub.
+	si *subIndex
+	// specifies how edge labels are compared when validating a mapping.
+	labels labelMode
+	// sub nodes in the order they are matched.
+	order []int
+	// parent[i] is the sub node, preceding order[i] in the match order, with an
+	// edge to order[i]; parent[0] is -1.
+	parent []int
+	// mapping from sub node ID to graph node ID; -1 for unmapped sub nodes.
+	core []int
+	// set of graph node IDs present in core.
+	used bitset
+	// when all is true, locate every isomorphism instead of only the first.
+	all bool
+	// isomorphisms located.
+	ms []map[string]string
+}
+
+// newState returns a new VF2 search state for isomorphisms of si in gi which
+// start at the entry node.
+func newState(graph *dot.Graph, gi *index, si *subIndex, entry string, labels labelMode) (*state, error) {
+	// Sanity checks.
+	g, ok := gi.ids[entry]
+	if !ok {
+		return nil, errutil.Newf("unable to locate entry node %q in graph", entry)
+	}
+	s := si.entry
+	if err := checkEntry(gi, si, g); err != nil {
+		return nil, errutil.Err(err)
+	}
+
+	st := &state{
+		graph:  graph,
+		gi:     gi,
+		si:     si,
+		labels: labels,
+		core:   make([]int, si.len()),
+		used:   newBitset(gi.len()),
+	}
+	for i := range st.core {
+		st.core[i] = -1
+	}
+	if !st.sameEdge(s, s, g, g) {
+		return nil, errutil.Newf("invalid entry node candidate %q; self-loop mismatch", entry)
+	}
+
+	// Order the sub nodes breadth-first from entry, visiting successors in
+	// sorted order to make the algorithm deterministic.
+	visited := newBitset(si.len())
+	visited.set(s)
+	st.order = append(st.order, s)
+	st.parent = append(st.parent, -1)
+	for i := 0; i < len(st.order); i++ {
+		n := st.order[i]
+		for _, succ := range si.succs[n] {
+			if visited.has(succ) {
+				continue
+			}
+			visited.set(succ)
+			st.order = append(st.order, succ)
+			st.parent = append(st.parent, n)
+		}
+	}
+	if len(st.order) != si.len() {
+		return nil, errutil.Newf("incomplete node order; expected %d sub nodes, got %d", si.len(), len(st.order))
+	}
+
+	st.core[s] = g
+	st.used.set(g)
+	return st, nil
+}
+
+// solveVF2 tries to locate an isomorphism of si in gi which starts at the entry
+// node, using the VF2 algorithm.
+func solveVF2(graph *dot.Graph, gi *index, si *subIndex, entry string, labels labelMode) (m map[string]string, err error) {
+	st, err := newState(graph, gi, si, entry, labels)
+	if err != nil {
+		return nil, err
+	}
+	st.match(1)
+	if len(st.ms) == 0 {
+		return nil, errutil.New("unable to locate node pair mapping")
+	}
+	return st.ms[0], nil
+}
+
+// solveAllVF2 returns every isomorphism of si in gi which starts at the entry
+// node, using the VF2 algorithm.
+func solveAllVF2(graph *dot.Graph, gi *index, si *subIndex, entry string, labels labelMode) []map[string]string {
+	st, err := newState(graph, gi, si, entry, labels)
+	if err != nil {
+		return nil
+	}
+	st.all = true
+	st.match(1)
+	return st.ms
+}
+
+// match recursively extends the mapping with the i:th sub node of the match
+// order. It returns true if the search should stop.
+func (st *state) match(i int) bool {
+	if i == len(st.order) {
+		if !st.isValid() {
+			return false
+		}
+		m := make(map[string]string, len(st.core))
+		for s, g := range st.core {
+			m[st.si.names[s]] = st.gi.names[g]
+		}
+		st.ms = append(st.ms, m)
+		return !st.all
+	}
+
+	// Candidate graph nodes are the unmapped successors of the graph node
+	// mapped to the parent of s; sorted by graph node ID.
+	s := st.order[i]
+	p := st.core[st.parent[i]]
+	for _, g := range st.gi.succs[p] {
+		if !st.isFeasible(s, g) {
+			continue
+		}
+		st.core[s] = g
+		st.used.set(g)
+		done := st.match(i + 1)
+		st.core[s] = -1
+		st.used.clear(g)
+		if done {
+			return true
+		}
+	}
+	return false
+}
+
+// isFeasible returns true if adding the node pair (s, g) to the mapping
+// preserves the edges between s and every sub node already mapped, and false
+// otherwise.
+func (st *state) isFeasible(s, g int) bool {
+	if st.used.has(g) || !isPotential(st.gi, st.si, g, s) {
+		return false
+	}
+	if !st.sameEdge(s, s, g, g) {
+		return false
+	}
+	for t, h := range st.core {
+		if h == -1 {
+			continue
+		}
+		if !st.sameEdge(t, s, h, g) {
+			return false
+		}
+		if !st.sameEdge(s, t, g, h) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameEdge returns true if the edge from ssrc to sdst in sub and the edge from
+// gsrc to gdst in graph are either both present or both absent, and false
+// otherwise. Edges from exit to entry are ignored, as both the predecessors of
+// entry and the successors of exit are ignored.
+func (st *state) sameEdge(ssrc, sdst, gsrc, gdst int) bool {
+	if ssrc == st.si.exit && sdst == st.si.entry {
+		return true
+	}
+	return st.si.hasEdge(ssrc, sdst) == st.gi.hasEdge(gsrc, gdst)
+}
+
+// isValid returns true if the complete mapping satisfies the dominance,
+// post-dominance and edge label constraints of the isomorphism, and false
+// otherwise.
+func (st *state) isValid() bool {
+	if st.si.exit != -1 && !st.gi.dominates(st.graph, st.core[st.si.entry], st.core[st.si.exit]) {
+		return false
+	}
+	if st.si.exit != -1 && !st.gi.isSESE(st.core[st.si.entry], st.core[st.si.exit]) {
+		return false
+	}
+	if st.labels != labelsIgnore {
+		inv, ok := polarity(st.gi, st.si, st.core)
+		if !ok {
+			return false
+		}
+		if st.labels == labelsExact && len(inv) > 0 {
+			return false
+		}
+	}
+	return true
+}
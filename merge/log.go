@@ -0,0 +1,331 @@
+package merge
+
+import (
+	"sort"
+
+	"decomp.org/x/graphs"
+	"decomp.org/x/graphs/dom"
+	"github.com/mewfork/dot"
+	"github.com/mewkiz/pkg/errutil"
+)
+
+// A Log records the merges applied to a graph, which enables the merges to be
+// undone; e.g. to try alternative reduction orders without re-parsing the
+// graph. The zero value is an empty log.
+type Log struct {
+	// Merges in the order they were applied.
+	recs []*record
+}
+
+// record represents a merge of nodes into a single node.
+type record struct {
+	// Node name of the merged node.
+	name string
+	// Graph node names of the entry and exit nodes; exit is the same as entry
+	// for subgraphs without an exit node.
+	entry, exit string
+	// Merged nodes, in the order of graph.
+	nodes []*nodeRecord
+	// Edges between merged nodes, in the order of graph; except for the edge
+	// from exit to entry, which is represented by a self-loop of the merged
+	// node.
+	edges []*edgeRecord
+	// Positions in graph.Edges.Edges of the edges removed by the merge; i.e. the
+	// edges between merged nodes, the incoming edges of entry and the outgoing
+	// edges of exit.
+	pos map[edgeKey]int
+}
+
+// nodeRecord represents a node, its attributes and its position in
+// graph.Nodes.Nodes.
+type nodeRecord struct {
+	name  string
+	attrs map[string]string
+	pos   int
+}
+
+// edgeRecord represents an edge and its attributes.
+type edgeRecord struct {
+	src, dst string
+	attrs    map[string]string
+}
+
+// edgeKey identifies an edge by source and destination node name.
+type edgeKey struct {
+	src, dst string
+}
+
+// Len returns the number of merges recorded by the log.
+func (l *Log) Len() int {
+	return len(l.recs)
+}
+
+// Merge merges the nodes of the isomorphism of sub in graph into a single node,
+// and records the merge in the log. If successful it returns the name of the
+// new node. The cached dominator trees of graph are invalidated in the given
+// caches.
+func (l *Log) Merge(graph *dot.Graph, m map[string]string, sub *graphs.SubGraph, caches ...*dom.Cache) (name string, err error) {
+	name = UniqName(graph, nil, sub.Name)
+	err = l.MergeAs(graph, m, sub, name, caches...)
+	if err != nil {
+		return "", errutil.Err(err)
+	}
+	return name, nil
+}
+
+// MergeAs merges the nodes of the isomorphism of sub in graph into a single
+// node with the given name, and records the merge in the log. The cached
+// dominator trees of graph are invalidated in the given caches.
+func (l *Log) MergeAs(graph *dot.Graph, m map[string]string, sub *graphs.SubGraph, name string, caches ...*dom.Cache) error {
+	rec := &record{name: name, entry: m[sub.Entry()], exit: m[sub.Entry()], pos: make(map[edgeKey]int)}
+	if len(sub.Exit()) > 0 {
+		rec.exit = m[sub.Exit()]
+	}
+	in := make(map[string]bool)
+	for _, gname := range m {
+		in[gname] = true
+	}
+	for i, node := range graph.Nodes.Nodes {
+		if in[node.Name] {
+			rec.nodes = append(rec.nodes, &nodeRecord{name: node.Name, attrs: copyAttrs(node.Attrs), pos: i})
+		}
+	}
+	for i, e := range graph.Edges.Edges {
+		if in[e.Src] || in[e.Dst] {
+			rec.pos[edgeKey{src: e.Src, dst: e.Dst}] = i
+		}
+		if !in[e.Src] || !in[e.Dst] {
+			continue
+		}
+		if len(sub.Exit()) > 0 && e.Src == rec.exit && e.Dst == rec.entry {
+			continue
+		}
+		rec.edges = append(rec.edges, &edgeRecord{src: e.Src, dst: e.Dst, attrs: copyAttrs(e.Attrs)})
+	}
+
+	err := MergeAs(graph, m, sub, name, caches...)
+	if err != nil {
+		return errutil.Err(err)
+	}
+	l.recs = append(l.recs, rec)
+	return nil
+}
+
+// Unmerge restores the original nodes and edges of the merged node with the
+// given name in graph, and removes the merge from the log. The merged node must
+// be present in graph; i.e. it must not have been merged into another node.
+//
+// Incoming edges of the merged node are redirected to the original entry node
+// and outgoing edges are redirected from the original exit node. The restored
+// nodes and edges are put back at their positions in graph.Nodes.Nodes and
+// graph.Edges.Edges before the merge. If the merges applied after the given
+// merge have already been undone, the graph is restored to its exact state
+// before the merge, including the order of nodes, edges, predecessors and
+// successors. The cached dominator trees of graph are
+// invalidated in the given caches.
+func (l *Log) Unmerge(graph *dot.Graph, name string, caches ...*dom.Cache) error {
+	// Locate the most recent merge of the given name, as node names may be
+	// reused once a merged node has been merged into another node.
+	i := len(l.recs) - 1
+	for ; i >= 0; i-- {
+		if l.recs[i].name == name {
+			break
+		}
+	}
+	if i < 0 {
+		return errutil.Newf("unable to locate merge of node %q in log", name)
+	}
+	rec := l.recs[i]
+	node, ok := graph.Nodes.Lookup[name]
+	if !ok {
+		return errutil.Newf("unable to locate merged node %q in graph", name)
+	}
+
+	// Record the edges of the merged node.
+	var preds, succs []*edgeRecord
+	var loop *edgeRecord
+	for _, e := range graph.Edges.Edges {
+		switch {
+		case e.Src == name && e.Dst == name:
+			loop = &edgeRecord{src: rec.exit, dst: rec.entry, attrs: copyAttrs(e.Attrs)}
+		case e.Dst == name:
+			preds = append(preds, &edgeRecord{src: e.Src, dst: rec.entry, attrs: copyAttrs(e.Attrs)})
+		case e.Src == name:
+			succs = append(succs, &edgeRecord{src: rec.exit, dst: e.Dst, attrs: copyAttrs(e.Attrs)})
+		}
+	}
+
+	// Replace the merged node with the original nodes and edges.
+	for _, n := range rec.nodes {
+		if _, ok := graph.Nodes.Lookup[n.name]; ok {
+			return errutil.Newf("unable to restore node %q; already present in graph", n.name)
+		}
+	}
+	defer invalidate(graph, caches)
+	delNode(graph, node)
+	nnodes := len(graph.Nodes.Nodes)
+	for _, n := range rec.nodes {
+		graph.AddNode(graph.Name, n.name, copyAttrs(n.attrs))
+	}
+	nedges := len(graph.Edges.Edges)
+	for _, e := range rec.edges {
+		graph.AddEdge(e.src, "", e.dst, "", true, copyAttrs(e.attrs))
+	}
+	for _, e := range preds {
+		graph.AddEdge(e.src, "", e.dst, "", true, e.attrs)
+	}
+	for _, e := range succs {
+		graph.AddEdge(e.src, "", e.dst, "", true, e.attrs)
+	}
+	if loop != nil {
+		graph.AddEdge(loop.src, "", loop.dst, "", true, loop.attrs)
+	}
+	rec.restoreOrder(graph, nnodes, nedges)
+
+	l.recs = append(l.recs[:i], l.recs[i+1:]...)
+	return nil
+}
+
+// Undo undoes the most recent merge recorded by the log. If successful it
+// returns the name of the merged node which was restored. The cached dominator
+// trees of graph are invalidated in the given caches.
+func (l *Log) Undo(graph *dot.Graph, caches ...*dom.Cache) (name string, err error) {
+	if len(l.recs) == 0 {
+		return "", errutil.New("unable to undo merge; empty log")
+	}
+	name = l.recs[len(l.recs)-1].name
+	err = l.Unmerge(graph, name, caches...)
+	if err != nil {
+		return "", errutil.Err(err)
+	}
+	return name, nil
+}
+
+// Rollback undoes the merges recorded by the log, in reverse order, until n
+// merges remain. The cached dominator trees of graph are invalidated in the
+// given caches.
+func (l *Log) Rollback(graph *dot.Graph, n int, caches ...*dom.Cache) error {
+	if n < 0 || n > len(l.recs) {
+		return errutil.Newf("invalid rollback; expected 0 <= n <= %d, got %d", len(l.recs), n)
+	}
+	for len(l.recs) > n {
+		_, err := l.Undo(graph, caches...)
+		if err != nil {
+			return errutil.Err(err)
+		}
+	}
+	return nil
+}
+
+// restoreOrder moves the nodes and edges restored by an unmerge of the record,
+// which are appended to graph.Nodes.Nodes and graph.Edges.Edges from the
+// positions nnodes and nedges respectively, back to their positions before the
+// merge. Restored edges without a recorded position (e.g. edges redirected to a
+// node merged later on) remain last. The predecessors and successors of the
+// nodes incident to restored edges are ordered as graph.Edges.Edges.
+func (rec *record) restoreOrder(graph *dot.Graph, nnodes, nedges int) {
+	// Restore node positions; the nodes are recorded in order of position.
+	nodes := graph.Nodes.Nodes[:nnodes:nnodes]
+	for _, n := range rec.nodes {
+		nodes = insertNode(nodes, graph.Nodes.Lookup[n.name], n.pos)
+	}
+	graph.Nodes.Nodes = nodes
+
+	// Restore edge positions.
+	restored := append([]*dot.Edge(nil), graph.Edges.Edges[nedges:]...)
+	sort.SliceStable(restored, func(i, j int) bool {
+		pi, oki := rec.pos[edgeKey{src: restored[i].Src, dst: restored[i].Dst}]
+		pj, okj := rec.pos[edgeKey{src: restored[j].Src, dst: restored[j].Dst}]
+		if oki != okj {
+			return oki
+		}
+		return oki && pi < pj
+	})
+	edges := graph.Edges.Edges[:nedges:nedges]
+	for _, e := range restored {
+		pos, ok := rec.pos[edgeKey{src: e.Src, dst: e.Dst}]
+		if !ok || pos > len(edges) {
+			pos = len(edges)
+		}
+		edges = append(edges, nil)
+		copy(edges[pos+1:], edges[pos:])
+		edges[pos] = e
+	}
+	graph.Edges.Edges = edges
+
+	// Order predecessors and successors as graph.Edges.Edges.
+	affected := make(map[string]bool)
+	for _, e := range restored {
+		affected[e.Src] = true
+		affected[e.Dst] = true
+	}
+	for name := range affected {
+		node := graph.Nodes.Lookup[name]
+		node.Preds, node.Succs = nil, nil
+	}
+	for _, e := range graph.Edges.Edges {
+		if affected[e.Src] {
+			src := graph.Nodes.Lookup[e.Src]
+			src.Succs = append(src.Succs, graph.Nodes.Lookup[e.Dst])
+		}
+		if affected[e.Dst] {
+			dst := graph.Nodes.Lookup[e.Dst]
+			dst.Preds = append(dst.Preds, graph.Nodes.Lookup[e.Src])
+		}
+	}
+}
+
+// insertNode inserts node into nodes at the given position, or last if the
+// position is out of range.
+func insertNode(nodes []*dot.Node, node *dot.Node, pos int) []*dot.Node {
+	if pos > len(nodes) {
+		pos = len(nodes)
+	}
+	nodes = append(nodes, nil)
+	copy(nodes[pos+1:], nodes[pos:])
+	nodes[pos] = node
+	return nodes
+}
+
+// delNode removes the node and its incoming and outgoing edges from graph.
+func delNode(graph *dot.Graph, node *dot.Node) {
+	name := node.Name
+
+	// Remove edges.
+	var edges []*dot.Edge
+	for _, e := range graph.Edges.Edges {
+		if e.Src != name && e.Dst != name {
+			edges = append(edges, e)
+		}
+	}
+	graph.Edges.Edges = edges
+	delete(graph.Edges.SrcToDsts, name)
+	for _, dsts := range graph.Edges.SrcToDsts {
+		delete(dsts, name)
+	}
+	delete(graph.Edges.DstToSrcs, name)
+	for _, srcs := range graph.Edges.DstToSrcs {
+		delete(srcs, name)
+	}
+	for _, pred := range node.Preds {
+		pred.Succs = without(pred.Succs, node)
+	}
+	for _, succ := range node.Succs {
+		succ.Preds = without(succ.Preds, node)
+	}
+
+	// Remove node.
+	delete(graph.Nodes.Lookup, name)
+	graph.Nodes.Nodes = without(graph.Nodes.Nodes, node)
+}
+
+// without returns the nodes of ns except x.
+func without(ns []*dot.Node, x *dot.Node) []*dot.Node {
+	var out []*dot.Node
+	for _, n := range ns {
+		if n != x {
+			out = append(out, n)
+		}
+	}
+	return out
+}
@@ -3,46 +3,179 @@ package merge
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"decomp.org/x/graphs"
+	"decomp.org/x/graphs/dom"
 	"github.com/mewfork/dot"
 	"github.com/mewkiz/pkg/errutil"
 )
 
 // Merge merges the nodes of the isomorphism of sub in graph into a single node.
-// If successful it returns the name of the new node.
-func Merge(graph *dot.Graph, m map[string]string, sub *graphs.SubGraph) (name string, err error) {
+// If successful it returns the name of the new node. The cached dominator trees
+// of graph are invalidated in the given caches.
+func Merge(graph *dot.Graph, m map[string]string, sub *graphs.SubGraph, caches ...*dom.Cache) (name string, err error) {
+	name = UniqName(graph, nil, sub.Name)
+	err = MergeAs(graph, m, sub, name, caches...)
+	if err != nil {
+		return "", errutil.Err(err)
+	}
+	return name, nil
+}
+
+// MergeAs merges the nodes of the isomorphism of sub in graph into a single
+// node with the given name. The cached dominator trees of graph are
+// invalidated in the given caches.
+//
+// The new node inherits the attributes of the entry node, and is annotated with
+// a "prim" attribute specifying the name of sub and a "nodes" attribute listing
+// the names of the merged nodes, ordered by sub node name; e.g.
+//
+//    if0 [prim="if", nodes="17,24,32"]
+//
+// The attributes (e.g. "true" and "false" labels) of the incoming edges of the
+// entry node and the outgoing edges of the exit node are preserved.
+func MergeAs(graph *dot.Graph, m map[string]string, sub *graphs.SubGraph, name string, caches ...*dom.Cache) error {
 	var nodes []*dot.Node
 	for _, gname := range m {
 		node, ok := graph.Nodes.Lookup[gname]
 		if !ok {
-			return "", errutil.Newf("unable to locate mapping for node %q", gname)
+			return errutil.Newf("unable to locate mapping for node %q", gname)
 		}
 		nodes = append(nodes, node)
 	}
-	name = uniqName(graph, sub.Name)
+	if _, ok := graph.Nodes.Lookup[name]; ok {
+		return errutil.Newf("node %q already present in graph", name)
+	}
 	entry, ok := graph.Nodes.Lookup[m[sub.Entry()]]
 	if !ok {
-		return "", errutil.Newf("unable to locate mapping for entry node %q", sub.Entry())
+		return errutil.Newf("unable to locate mapping for entry node %q", sub.Entry())
 	}
-	exit, ok := graph.Nodes.Lookup[m[sub.Exit()]]
-	if !ok {
-		return "", errutil.Newf("unable to locate mapping for exit node %q", sub.Exit())
+	// Subgraphs without an exit node have no outgoing edges to redirect; use
+	// the entry node in place of the exit node.
+	exit := entry
+	if len(sub.Exit()) > 0 {
+		exit, ok = graph.Nodes.Lookup[m[sub.Exit()]]
+		if !ok {
+			return errutil.Newf("unable to locate mapping for exit node %q", sub.Exit())
+		}
+	}
+
+	// Record the attributes of the entry node and of the edges which are
+	// redirected to the new node.
+	in := make(map[string]bool)
+	for _, gname := range m {
+		in[gname] = true
+	}
+	attrs := copyAttrs(entry.Attrs)
+	preds := make(map[string]map[string]string)
+	for _, pred := range entry.Preds {
+		if e, ok := graph.Edges.SrcToDsts[pred.Name][entry.Name]; ok && !in[pred.Name] {
+			preds[pred.Name] = copyAttrs(e.Attrs)
+		}
+	}
+	succs := make(map[string]map[string]string)
+	if len(sub.Exit()) > 0 {
+		for _, succ := range exit.Succs {
+			if e, ok := graph.Edges.SrcToDsts[exit.Name][succ.Name]; ok && !in[succ.Name] {
+				succs[succ.Name] = copyAttrs(e.Attrs)
+			}
+		}
+	}
+
+	// An edge from exit to entry (e.g. the back edge of a loop body) becomes a
+	// self-loop of the new node.
+	var loop map[string]string
+	if e, ok := graph.Edges.SrcToDsts[exit.Name][entry.Name]; ok && len(sub.Exit()) > 0 {
+		loop = copyAttrs(e.Attrs)
 	}
-	err = graph.Replace(nodes, name, entry, exit)
+
+	err := graph.Replace(nodes, name, entry, exit)
+	invalidate(graph, caches)
 	if err != nil {
-		return "", errutil.Err(err)
+		return errutil.Err(err)
 	}
-	return name, nil
+	if _, ok := graph.Edges.SrcToDsts[name][name]; loop != nil && !ok {
+		graph.AddEdge(name, "", name, "", true, loop)
+	}
+
+	// Restore the recorded attributes.
+	node, ok := graph.Nodes.Lookup[name]
+	if !ok {
+		return errutil.Newf("unable to locate merged node %q", name)
+	}
+	for key, val := range attrs {
+		node.Attrs[key] = val
+	}
+	node.Attrs["prim"] = sub.Name
+	node.Attrs["nodes"] = nodeNames(m)
+	for pred, attrs := range preds {
+		setEdgeAttrs(graph, pred, name, attrs)
+	}
+	for succ, attrs := range succs {
+		setEdgeAttrs(graph, name, succ, attrs)
+	}
+	return nil
+}
+
+// invalidate invalidates the cached dominator trees of graph in the given
+// caches; nil caches are ignored.
+func invalidate(graph *dot.Graph, caches []*dom.Cache) {
+	for _, c := range caches {
+		if c != nil {
+			c.Invalidate(graph)
+		}
+	}
+}
+
+// copyAttrs returns a copy of the given attributes.
+func copyAttrs(attrs map[string]string) map[string]string {
+	dup := make(map[string]string, len(attrs))
+	for key, val := range attrs {
+		dup[key] = val
+	}
+	return dup
 }
 
-// uniqName returns name with a uniq numeric suffix.
-func uniqName(graph *dot.Graph, name string) string {
+// setEdgeAttrs sets the given attributes of the edge from src to dst in graph.
+func setEdgeAttrs(graph *dot.Graph, src, dst string, attrs map[string]string) {
+	e, ok := graph.Edges.SrcToDsts[src][dst]
+	if !ok {
+		return
+	}
+	for key, val := range attrs {
+		e.Attrs[key] = val
+	}
+}
+
+// nodeNames returns a comma-separated list of the graph node names of m,
+// ordered by sub node name.
+func nodeNames(m map[string]string) string {
+	var snames []string
+	for sname := range m {
+		snames = append(snames, sname)
+	}
+	sort.Strings(snames)
+	var gnames []string
+	for _, sname := range snames {
+		gnames = append(gnames, m[sname])
+	}
+	return strings.Join(gnames, ",")
+}
+
+// UniqName returns name with a numeric suffix which is unique among both the
+// nodes of graph and the used node names, and marks it as used. A nil set of
+// used node names is ignored.
+func UniqName(graph *dot.Graph, used map[string]bool, name string) string {
 	for id := 0; ; id++ {
 		s := fmt.Sprintf("%s%d", name, id)
-		_, ok := graph.Nodes.Lookup[s]
-		if !ok {
-			return s
+		if _, ok := graph.Nodes.Lookup[s]; ok || used[s] {
+			continue
+		}
+		if used != nil {
+			used[s] = true
 		}
+		return s
 	}
 }
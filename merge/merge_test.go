@@ -0,0 +1,217 @@
+package merge
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"decomp.org/x/graphs"
+	"decomp.org/x/graphs/dom"
+	"decomp.org/x/graphs/iso"
+	"github.com/mewfork/dot"
+)
+
+const src = `digraph f {
+	0->1 [label="true"]
+	0->3 [label="false"]
+	1->2
+	2->3 [label="x"]
+	2->1 [label="back"]
+	0 [label="entry"]
+	1 [label="L"]
+	2
+	3
+}`
+
+func TestMerge(t *testing.T) {
+	graph, err := dot.Read([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := graphs.ParseSubGraph("../testdata/primitives/list.dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := Merge(graph, map[string]string{"A": "1", "B": "2"}, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "list0" {
+		t.Errorf("node name mismatch; expected %q, got %q", "list0", name)
+	}
+
+	// Node attributes.
+	node, ok := graph.Nodes.Lookup[name]
+	if !ok {
+		t.Fatalf("unable to locate merged node %q", name)
+	}
+	want := map[string]string{"label": "L", "prim": "list", "nodes": "1,2"}
+	if got := map[string]string(node.Attrs); !reflect.DeepEqual(got, want) {
+		t.Errorf("node attributes mismatch; expected %v, got %v", want, got)
+	}
+
+	// Edge attributes.
+	edges := []struct {
+		src, dst string
+		want     map[string]string
+	}{
+		{src: "0", dst: name, want: map[string]string{"label": "true"}},
+		{src: "0", dst: "3", want: map[string]string{"label": "false"}},
+		{src: name, dst: "3", want: map[string]string{"label": "x"}},
+		{src: name, dst: name, want: map[string]string{"label": "back"}},
+	}
+	for _, e := range edges {
+		edge, ok := graph.Edges.SrcToDsts[e.src][e.dst]
+		if !ok {
+			t.Errorf("unable to locate edge from %q to %q", e.src, e.dst)
+			continue
+		}
+		if got := map[string]string(edge.Attrs); !reflect.DeepEqual(got, e.want) {
+			t.Errorf("edge from %q to %q: attributes mismatch; expected %v, got %v", e.src, e.dst, e.want, got)
+		}
+	}
+}
+
+func TestLogRollback(t *testing.T) {
+	graph, err := dot.ParseFile("../testdata/c4_graphs/stmt.dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := graphKey(graph)
+
+	// Merge primitives until no further isomorphisms are located.
+	var subs []*graphs.SubGraph
+	for _, name := range []string{"list", "if", "if_else", "if_return", "pre_loop"} {
+		sub, err := graphs.ParseSubGraph(filepath.Join("../testdata/primitives", name+".dot"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs = append(subs, sub)
+	}
+	var l Log
+	var keys []string
+	for merged := true; merged; {
+		merged = false
+		for _, sub := range subs {
+			match, ok := iso.Search(graph, sub)
+			if !ok {
+				continue
+			}
+			keys = append(keys, graphKey(graph))
+			if _, err := l.Merge(graph, match, sub); err != nil {
+				t.Fatal(err)
+			}
+			merged = true
+			break
+		}
+	}
+	if len(graph.Nodes.Nodes) != 1 {
+		t.Fatalf("node count mismatch; expected 1, got %d", len(graph.Nodes.Nodes))
+	}
+	if l.Len() != len(keys) {
+		t.Fatalf("log length mismatch; expected %d, got %d", len(keys), l.Len())
+	}
+
+	// Undo the most recent merges one at a time.
+	for i := 0; i < 3; i++ {
+		n := l.Len() - 1
+		if _, err := l.Undo(graph); err != nil {
+			t.Fatal(err)
+		}
+		if got := graphKey(graph); got != keys[n] {
+			t.Errorf("undo %d: graph mismatch; expected\n%s\ngot\n%s", n, keys[n], got)
+		}
+	}
+
+	// Roll back the remaining merges.
+	if err := l.Rollback(graph, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := graphKey(graph); got != orig {
+		t.Errorf("rollback: graph mismatch; expected\n%s\ngot\n%s", orig, got)
+	}
+	if _, err := l.Undo(graph); err == nil {
+		t.Errorf("undo of empty log: expected error, got nil")
+	}
+}
+
+func TestLogUnmerge(t *testing.T) {
+	graph, err := dot.Read([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := graphKey(graph)
+	sub, err := graphs.ParseSubGraph("../testdata/primitives/list.dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var l Log
+	name, err := l.Merge(graph, map[string]string{"A": "1", "B": "2"}, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Unmerge(graph, "foo"); err == nil {
+		t.Errorf("unmerge of unknown node: expected error, got nil")
+	}
+	if err := l.Unmerge(graph, name); err != nil {
+		t.Fatal(err)
+	}
+	if got := graphKey(graph); got != orig {
+		t.Errorf("graph mismatch; expected\n%s\ngot\n%s", orig, got)
+	}
+	if l.Len() != 0 {
+		t.Errorf("log length mismatch; expected 0, got %d", l.Len())
+	}
+}
+
+func TestMergeInvalidate(t *testing.T) {
+	graph, err := dot.Read([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := graphs.ParseSubGraph("../testdata/primitives/list.dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &dom.Cache{}
+	c.Tree(graph)
+	var l Log
+	name, err := l.Merge(graph, map[string]string{"A": "1", "B": "2"}, sub, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idom, ok := c.Tree(graph).Idom(name); !ok || idom != "0" {
+		t.Errorf("immediate dominator mismatch of merged node %q; expected %q, got %q", name, "0", idom)
+	}
+	if err := l.Unmerge(graph, name, c); err != nil {
+		t.Fatal(err)
+	}
+	if idom, ok := c.Tree(graph).Idom("2"); !ok || idom != "1" {
+		t.Errorf("immediate dominator mismatch of restored node %q; expected %q, got %q", "2", "1", idom)
+	}
+}
+
+// graphKey returns a string representation of graph, as given by its String
+// method, followed by the predecessors and successors of each node. The order
+// of nodes, edges, predecessors and successors is preserved.
+func graphKey(graph *dot.Graph) string {
+	lines := []string{graph.String()}
+	for _, node := range graph.Nodes.Nodes {
+		var preds, succs []string
+		for _, pred := range node.Preds {
+			preds = append(preds, pred.Name)
+		}
+		for _, succ := range node.Succs {
+			succs = append(succs, succ.Name)
+		}
+		lines = append(lines, fmt.Sprintf("%s preds=%v succs=%v", node.Name, preds, succs))
+	}
+	for _, e := range graph.Edges.Edges {
+		if graph.Edges.SrcToDsts[e.Src][e.Dst] != e {
+			lines = append(lines, fmt.Sprintf("%s->%s missing from SrcToDsts", e.Src, e.Dst))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,124 @@
+// Package patterns provides a library of subgraph patterns of high-level
+// control flow primitives, which are looked up by name.
+//
+// The standard patterns (e.g. "if", "pre_loop") are embedded in the package.
+// Additional patterns, or replacements of standard patterns, are located in
+// user specified directories, in which the pattern NAME is stored as the DOT
+// file NAME.dot.
+package patterns
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"decomp.org/x/graphs"
+	"github.com/mewfork/dot"
+	"github.com/mewkiz/pkg/errutil"
+)
+
+// Version specifies the version of the standard pattern library. The version
+// is incremented whenever a standard pattern is added, removed or modified.
+const Version = "1.0.0"
+
+// EnvPath specifies the name of the environment variable which lists the
+// directories searched for patterns before the standard patterns, separated
+// by os.PathListSeparator.
+const EnvPath = "GRAPHS_PATTERNS"
+
+// std holds the DOT files of the standard patterns.
+//
+//go:embed std/*.dot
+var std embed.FS
+
+// A Library is a collection of subgraph patterns, looked up by name. The zero
+// value is a library of the standard patterns.
+type Library struct {
+	// Directories searched for patterns, in order, before the standard
+	// patterns.
+	Dirs []string
+}
+
+// New returns a pattern library which searches the given directories, followed
+// by the directories listed by the GRAPHS_PATTERNS environment variable, before
+// the standard patterns.
+func New(dirs ...string) *Library {
+	lib := &Library{Dirs: append([]string(nil), dirs...)}
+	for _, dir := range filepath.SplitList(os.Getenv(EnvPath)) {
+		if len(dir) > 0 {
+			lib.Dirs = append(lib.Dirs, dir)
+		}
+	}
+	return lib
+}
+
+// Lookup returns the subgraph of the pattern with the given name (e.g. "if"),
+// as located by New.
+func Lookup(name string) (*graphs.SubGraph, error) {
+	return New().Lookup(name)
+}
+
+// Lookup returns the subgraph of the pattern with the given name (e.g. "if").
+// The first directory of the library which contains the pattern takes
+// precedence, followed by the standard patterns.
+func (lib *Library) Lookup(name string) (*graphs.SubGraph, error) {
+	if len(name) == 0 || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return nil, errutil.Newf("invalid pattern name %q", name)
+	}
+	for _, dir := range lib.Dirs {
+		dotPath := filepath.Join(dir, name+".dot")
+		if _, err := os.Stat(dotPath); err != nil {
+			continue
+		}
+		sub, err := graphs.ParseSubGraph(dotPath)
+		if err != nil {
+			return nil, errutil.Newf("unable to parse pattern %q; %v", dotPath, err)
+		}
+		return sub, nil
+	}
+	buf, err := std.ReadFile("std/" + name + ".dot")
+	if err != nil {
+		return nil, errutil.Newf("unable to locate pattern %q", name)
+	}
+	graph, err := dot.Read(buf)
+	if err != nil {
+		return nil, errutil.Newf("unable to parse standard pattern %q; %v", name, err)
+	}
+	sub, err := graphs.NewSubGraph(graph)
+	if err != nil {
+		return nil, errutil.Newf("unable to parse standard pattern %q; %v", name, err)
+	}
+	return sub, nil
+}
+
+// Names returns the sorted names of the patterns of the library, including the
+// standard patterns.
+func (lib *Library) Names() ([]string, error) {
+	set := make(map[string]bool)
+	for _, dir := range lib.Dirs {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.dot"))
+		if err != nil {
+			return nil, errutil.Err(err)
+		}
+		for _, p := range paths {
+			set[strings.TrimSuffix(filepath.Base(p), ".dot")] = true
+		}
+	}
+	paths, err := fs.Glob(std, "std/*.dot")
+	if err != nil {
+		return nil, errutil.Err(err)
+	}
+	for _, p := range paths {
+		set[strings.TrimSuffix(path.Base(p), ".dot")] = true
+	}
+	var names []string
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
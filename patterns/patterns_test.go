@@ -0,0 +1,99 @@
+package patterns
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"decomp.org/x/graphs"
+)
+
+func TestLookup(t *testing.T) {
+	names, err := (&Library{}).Names()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"if", "if_else", "if_return", "inf_loop", "list", "post_loop", "pre_loop"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("names mismatch; expected %v, got %v", want, names)
+	}
+	for i, name := range names {
+		sub, err := (&Library{}).Lookup(name)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		if sub.Name != name {
+			t.Errorf("i=%d: name mismatch; expected %q, got %q", i, name, sub.Name)
+		}
+		// The standard patterns are kept in sync with the test data.
+		orig, err := graphs.ParseSubGraph(filepath.Join("../testdata/primitives", name+".dot"))
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		if sub.String() != orig.String() {
+			t.Errorf("i=%d: pattern %q mismatch; expected %v, got %v", i, name, orig, sub)
+		}
+	}
+}
+
+func TestLookupDirs(t *testing.T) {
+	dir := t.TempDir()
+	// Replace a standard pattern, and add a new pattern.
+	files := map[string]string{
+		"list.dot": "digraph list {\n\tA [label=\"entry\"]\n\tB [label=\"exit\"]\n\tA->B\n}\n",
+		"seq.dot":  "digraph seq {\n\tA [label=\"entry\"]\n\tB\n\tC [label=\"exit\"]\n\tA->B\n\tB->C\n}\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lib := &Library{Dirs: []string{dir}}
+
+	golden := []struct {
+		name string
+		// Number of nodes of the pattern; 0 if not found.
+		n int
+	}{
+		// i=0
+		{name: "list", n: 2},
+		// i=1
+		{name: "seq", n: 3},
+		// i=2
+		{name: "if", n: 3},
+		// i=3
+		{name: "unknown", n: 0},
+		// i=4
+		{name: "../primitives/if", n: 0},
+		// i=5
+		{name: "", n: 0},
+	}
+	for i, g := range golden {
+		sub, err := lib.Lookup(g.name)
+		if g.n == 0 {
+			if err == nil {
+				t.Errorf("i=%d: expected error for pattern %q, got nil", i, g.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		if n := len(sub.Nodes.Nodes); n != g.n {
+			t.Errorf("i=%d: node count mismatch; expected %d, got %d", i, g.n, n)
+		}
+	}
+
+	names, err := lib.Names()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"if", "if_else", "if_return", "inf_loop", "list", "post_loop", "pre_loop", "seq"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("names mismatch; expected %v, got %v", want, names)
+	}
+}
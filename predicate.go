@@ -0,0 +1,154 @@
+package graphs
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mewkiz/pkg/errutil"
+)
+
+// A Predicate is a constraint on an attribute of the graph nodes matched by a
+// sub node. Predicates are specified using sub node attributes with a prefix
+// which determines the kind of constraint, e.g.
+//
+//    digraph if_return {
+//       A [role="entry"]
+//       B [role="return", re_label="\bret\b", has_kind="true"]
+//       C [role="exit", eq_kind="block"]
+//       A->B [label="true"]
+//       A->C [label="false"]
+//    }
+//
+// The prefixes are as follows.
+//
+//    eq_KEY="VALUE"     attribute KEY is present and equal to VALUE
+//    re_KEY="REGEXP"    attribute KEY is present and matches the regular
+//                       expression REGEXP (unanchored, RE2 syntax)
+//    has_KEY="true"     attribute KEY is present
+//    has_KEY="false"    attribute KEY is absent
+type Predicate struct {
+	// Kind of constraint.
+	Kind PredicateKind
+	// Attribute name.
+	Key string
+	// Attribute value of PredEqual, or regular expression of PredMatch.
+	Value string
+	// Compiled regular expression of PredMatch.
+	re *regexp.Regexp
+}
+
+// PredicateKind specifies the kind of constraint of a predicate.
+type PredicateKind int
+
+// Predicate kinds.
+const (
+	// PredEqual requires the attribute to be equal to a value.
+	PredEqual PredicateKind = iota
+	// PredMatch requires the attribute to match a regular expression.
+	PredMatch
+	// PredPresent requires the attribute to be present.
+	PredPresent
+	// PredAbsent requires the attribute to be absent.
+	PredAbsent
+)
+
+// Holds reports whether the node attributes satisfy the predicate.
+func (p *Predicate) Holds(attrs map[string]string) bool {
+	val, ok := attrs[p.Key]
+	switch p.Kind {
+	case PredEqual:
+		return ok && val == p.Value
+	case PredMatch:
+		return ok && p.re.MatchString(val)
+	case PredPresent:
+		return ok
+	case PredAbsent:
+		return !ok
+	}
+	panic(fmt.Sprintf("unknown predicate kind %d", int(p.Kind)))
+}
+
+// String returns the sub node attribute which specifies the predicate, e.g.
+//
+//    eq_kind="call"
+func (p *Predicate) String() string {
+	switch p.Kind {
+	case PredEqual:
+		return fmt.Sprintf("eq_%s=%q", p.Key, p.Value)
+	case PredMatch:
+		return fmt.Sprintf("re_%s=%q", p.Key, p.Value)
+	case PredPresent:
+		return fmt.Sprintf("has_%s=%q", p.Key, "true")
+	case PredAbsent:
+		return fmt.Sprintf("has_%s=%q", p.Key, "false")
+	}
+	return fmt.Sprintf("unknown predicate kind %d", int(p.Kind))
+}
+
+// Predicates returns the predicates of the given sub node, sorted by attribute
+// name.
+func (sub *SubGraph) Predicates(name string) []*Predicate {
+	return sub.preds[name]
+}
+
+// predicatePrefixes specifies the sub node attribute prefixes of predicates.
+var predicatePrefixes = []string{"eq_", "re_", "has_"}
+
+// isPredicate reports whether the sub node attribute key specifies a predicate.
+func isPredicate(key string) bool {
+	for _, prefix := range predicatePrefixes {
+		if strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePredicates parses the predicates specified by the attributes of the
+// given sub node.
+func parsePredicates(name string, attrs map[string]string) ([]*Predicate, error) {
+	var preds []*Predicate
+	for key, val := range attrs {
+		if !isPredicate(key) {
+			continue
+		}
+		p := &Predicate{}
+		switch {
+		case strings.HasPrefix(key, "eq_"):
+			p.Kind, p.Key, p.Value = PredEqual, key[len("eq_"):], val
+		case strings.HasPrefix(key, "re_"):
+			re, err := regexp.Compile(val)
+			if err != nil {
+				return nil, errutil.Newf("invalid %q attribute of node %q; %v", key, name, err)
+			}
+			p.Kind, p.Key, p.Value, p.re = PredMatch, key[len("re_"):], val, re
+		case strings.HasPrefix(key, "has_"):
+			p.Key = key[len("has_"):]
+			switch val {
+			case "true":
+				p.Kind = PredPresent
+			case "false":
+				p.Kind = PredAbsent
+			default:
+				return nil, errutil.Newf(`invalid %q attribute %q of node %q; expected "true" or "false"`, key, val, name)
+			}
+		}
+		preds = append(preds, p)
+	}
+	sort.Sort(byKey(preds))
+	return preds, nil
+}
+
+// byKey sorts predicates by attribute name and kind.
+type byKey []*Predicate
+
+func (ps byKey) Len() int { return len(ps) }
+func (ps byKey) Less(i, j int) bool {
+	if ps[i].Key != ps[j].Key {
+		return ps[i].Key < ps[j].Key
+	}
+	return ps[i].Kind < ps[j].Kind
+}
+func (ps byKey) Swap(i, j int) { ps[i], ps[j] = ps[j], ps[i] }
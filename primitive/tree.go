@@ -0,0 +1,83 @@
+package primitive
+
+import (
+	"sort"
+)
+
+// A Node represents a node of a control flow structure tree; either a node of
+// the original control flow graph, or a merged node of a high-level control
+// flow primitive with the nodes it contains as children.
+type Node struct {
+	// Node name; e.g. "17", "if0".
+	Name string `json:"name"`
+	// Primitive name of merged nodes; e.g. "if", "pre_loop", ... Empty for
+	// nodes of the original control flow graph.
+	Prim string `json:"prim,omitempty"`
+	// Role of the node in its parent primitive, as the subgraph node name of the
+	// primitive; e.g. "A". Empty for root nodes.
+	Role string `json:"role,omitempty"`
+	// Child nodes of merged nodes, sorted by role.
+	Children []*Node `json:"children,omitempty"`
+}
+
+// NewTree returns the control flow structure trees of the given primitives,
+// which are specified in the order they were merged. Nodes of a primitive refer
+// either to nodes of the original control flow graph or to primitives merged
+// before it. A node name which is reused by a later primitive refers to the
+// most recently merged primitive of that name.
+//
+// The root nodes are returned in the order they were merged. If the control
+// flow graph was reduced to a single node, a single root node is returned.
+func NewTree(prims []*Primitive) []*Node {
+	// Merged nodes not yet contained within another primitive.
+	merged := make(map[string]*Node)
+	var roots []*Node
+	for _, prim := range prims {
+		node := &Node{Name: prim.Node, Prim: prim.Prim}
+		// Sort roles to make the algorithm deterministic.
+		var roles []string
+		for role := range prim.Nodes {
+			roles = append(roles, role)
+		}
+		sort.Strings(roles)
+		for _, role := range roles {
+			name := prim.Nodes[role]
+			child, ok := merged[name]
+			if ok {
+				delete(merged, name)
+			} else {
+				child = &Node{Name: name}
+			}
+			child.Role = role
+			node.Children = append(node.Children, child)
+		}
+		merged[prim.Node] = node
+		roots = append(roots, node)
+	}
+
+	// Remove root nodes contained within other primitives.
+	var rs []*Node
+	for _, root := range roots {
+		if len(root.Role) == 0 {
+			rs = append(rs, root)
+		}
+	}
+	return rs
+}
+
+// Walk traverses the tree rooted at node in depth-first order, calling f for
+// each node and its depth in the tree, starting with node at depth 0. If f
+// returns false, the children of the node are not traversed.
+func (node *Node) Walk(f func(n *Node, depth int) bool) {
+	node.walk(f, 0)
+}
+
+// walk traverses the tree rooted at node in depth-first order.
+func (node *Node) walk(f func(n *Node, depth int) bool, depth int) {
+	if !f(node, depth) {
+		return
+	}
+	for _, child := range node.Children {
+		child.walk(f, depth+1)
+	}
+}
@@ -0,0 +1,92 @@
+package primitive
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewTree(t *testing.T) {
+	prims := []*Primitive{
+		{Prim: "list", Node: "list0", Nodes: map[string]string{"A": "1", "B": "2"}},
+		{Prim: "inf_loop", Node: "inf_loop0", Nodes: map[string]string{"A": "list0"}},
+		{Prim: "list", Node: "list1", Nodes: map[string]string{"A": "0", "B": "inf_loop0"}},
+	}
+	want := []*Node{
+		{
+			Name: "list1",
+			Prim: "list",
+			Children: []*Node{
+				{Name: "0", Role: "A"},
+				{
+					Name: "inf_loop0",
+					Prim: "inf_loop",
+					Role: "B",
+					Children: []*Node{
+						{
+							Name: "list0",
+							Prim: "list",
+							Role: "A",
+							Children: []*Node{
+								{Name: "1", Role: "A"},
+								{Name: "2", Role: "B"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	got := NewTree(prims)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("tree mismatch; expected %v, got %v", want, got)
+	}
+
+	// Depth-first traversal.
+	var names []string
+	got[0].Walk(func(n *Node, depth int) bool {
+		names = append(names, strings.Repeat(" ", depth)+n.Name)
+		return true
+	})
+	wantNames := []string{"list1", " 0", " inf_loop0", "  list0", "   1", "   2"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("walk mismatch; expected %q, got %q", wantNames, names)
+	}
+
+	// JSON round trip.
+	buf, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nodes []*Node
+	if err := json.Unmarshal(buf, &nodes); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(nodes, want) {
+		t.Errorf("JSON round trip mismatch; expected %v, got %v", want, nodes)
+	}
+}
+
+func TestNewTreeReusedName(t *testing.T) {
+	// The node name "list0" is reused once the first "list0" primitive has been
+	// merged into "list1".
+	prims := []*Primitive{
+		{Prim: "list", Node: "list0", Nodes: map[string]string{"A": "1", "B": "2"}},
+		{Prim: "list", Node: "list1", Nodes: map[string]string{"A": "list0", "B": "3"}},
+		{Prim: "list", Node: "list0", Nodes: map[string]string{"A": "list1", "B": "4"}},
+	}
+	got := NewTree(prims)
+	if len(got) != 1 {
+		t.Fatalf("root count mismatch; expected 1, got %d", len(got))
+	}
+	var names []string
+	got[0].Walk(func(n *Node, depth int) bool {
+		names = append(names, n.Name)
+		return true
+	})
+	want := []string{"list0", "list1", "list0", "1", "2", "3", "4"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("walk mismatch; expected %q, got %q", want, names)
+	}
+}
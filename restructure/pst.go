@@ -0,0 +1,243 @@
+package restructure
+
+import (
+	"sort"
+
+	"decomp.org/x/graphs"
+	"decomp.org/x/graphs/analysis"
+	"decomp.org/x/graphs/dom"
+	"decomp.org/x/graphs/iso"
+	"decomp.org/x/graphs/merge"
+	"decomp.org/x/graphs/primitive"
+	"github.com/mewfork/dot"
+	"github.com/mewkiz/pkg/errutil"
+)
+
+// Unstructured is the primitive name of regions which match no control flow
+// primitive.
+const Unstructured = "unstructured"
+
+// Classify classifies the canonical single-entry/single-exit regions of the
+// program structure tree of graph as control flow primitives. Graph is not
+// modified.
+//
+// The regions are classified bottom-up, with each nested region collapsed into
+// a single node. Sequences of nodes within a region are first merged using the
+// "list" subgraph, if present in subs. A region is classified as the highest
+// priority subgraph of subs with an isomorphism which starts at the entry node
+// of the region and covers every node of the region; the exit node of the
+// subgraph may be mapped to the node outside the region which succeeds it
+// (e.g. the exit node of a pre-test loop), in which case the node is omitted
+// from the node mapping of the primitive. Regions without such an isomorphism
+// are classified as Unstructured, with a node mapping from each node name of
+// the region to itself. Regions which collapse into a single node without a
+// self-loop contain no control flow and are not classified.
+//
+// The primitives are returned in the order they were classified, which is
+// compatible with primitive.NewTree; the outermost primitive is last. The node
+// names of the primitives are unique among the nodes of graph.
+func Classify(graph *dot.Graph, subs []*graphs.SubGraph, matcher iso.Matcher) ([]*primitive.Primitive, error) {
+	root, err := analysis.ProgramStructureTree(graph)
+	if err != nil {
+		return nil, errutil.Err(err)
+	}
+	entry, err := analysis.Entry(graph)
+	if err != nil {
+		return nil, errutil.Err(err)
+	}
+	// The region graphs are modified by merges; cache their dominator trees
+	// between merges.
+	matcher.Dom = &dom.Cache{}
+	c := &classifier{graph: graph, subs: subs, matcher: matcher, entry: entry.Name, used: make(map[string]bool)}
+	for _, sub := range subs {
+		if sub.Name == "list" {
+			c.list = sub
+		}
+	}
+	if _, err := c.classify(root); err != nil {
+		return nil, errutil.Err(err)
+	}
+	return c.prims, nil
+}
+
+// classifier tracks the state of a region classification.
+type classifier struct {
+	graph   *dot.Graph
+	subs    []*graphs.SubGraph
+	matcher iso.Matcher
+	// entry node name of graph.
+	entry string
+	// "list" subgraph; nil if not present.
+	list *graphs.SubGraph
+	// node names of the primitives classified so far.
+	used map[string]bool
+	// primitives classified so far.
+	prims []*primitive.Primitive
+}
+
+// classify classifies the regions of the tree rooted at node, and returns the
+// name of the node representing the region within its parent region.
+func (c *classifier) classify(node *analysis.PSTNode) (string, error) {
+	// Collapse nested regions.
+	rep := make(map[string]string)
+	var nodes []string
+	for _, name := range node.Nodes {
+		rep[name] = name
+		nodes = append(nodes, name)
+	}
+	for _, child := range node.Children {
+		name, err := c.classify(child)
+		if err != nil {
+			return "", errutil.Err(err)
+		}
+		for _, n := range child.Region.Nodes {
+			rep[n] = name
+			nodes = append(nodes, n)
+		}
+	}
+	sort.Strings(nodes)
+
+	// Create the region graph.
+	entry, exit := c.entry, ""
+	if node.Region != nil {
+		entry, exit = node.Region.Entry.Dst, node.Region.Exit.Src
+	}
+	rg := dot.NewGraph()
+	rg.SetName("region")
+	// Release the cached dominator trees of the region graph once classified.
+	defer c.matcher.Dom.Invalidate(rg)
+	for _, n := range nodes {
+		r := rep[n]
+		if _, ok := rg.Nodes.Lookup[r]; ok {
+			continue
+		}
+		var attrs map[string]string
+		if r == rep[entry] {
+			attrs = map[string]string{"label": "entry"}
+		}
+		rg.AddNode("region", r, attrs)
+	}
+	for _, n := range nodes {
+		for _, succ := range c.graph.Nodes.Lookup[n].Succs {
+			src, dst := rep[n], rep[succ.Name]
+			if len(dst) == 0 || (src == dst && src != n) {
+				// Edge leaving the region, or within a nested region.
+				continue
+			}
+			c.addEdge(rg, n, succ.Name, src, dst)
+		}
+	}
+
+	// Add the node succeeding the region.
+	entryRep, exitRep := rep[entry], rep[exit]
+	follow := ""
+	if node.Region != nil && len(node.Region.Exit.Dst) > 0 {
+		follow = node.Region.Exit.Dst
+		rg.AddNode("region", follow, nil)
+		c.addEdge(rg, exit, follow, exitRep, follow)
+	}
+
+	// Merge sequences of nodes within the region.
+	for c.list != nil {
+		match, ok := c.findList(rg, follow)
+		if !ok {
+			break
+		}
+		name := merge.UniqName(c.graph, c.used, c.list.Name)
+		if err := merge.MergeAs(rg, match.Nodes, c.list, name, c.matcher.Dom); err != nil {
+			return "", errutil.Err(err)
+		}
+		for _, n := range match.Nodes {
+			if n == entryRep {
+				entryRep = name
+			}
+			if n == exitRep {
+				exitRep = name
+			}
+		}
+		c.prims = append(c.prims, &primitive.Primitive{Prim: c.list.Name, Node: name, Nodes: match.Nodes})
+	}
+	if n := len(rg.Nodes.Nodes); n == 1 || (n == 2 && len(follow) > 0) {
+		if _, ok := rg.Edges.SrcToDsts[entryRep][entryRep]; !ok {
+			// No control flow within the region.
+			return entryRep, nil
+		}
+	}
+
+	// Classify region.
+	for _, sub := range c.subs {
+		match, ok := c.matcher.Isomorphism(rg, entryRep, sub)
+		if !ok || !covers(rg, match.Nodes, sub, follow) {
+			continue
+		}
+		name := merge.UniqName(c.graph, c.used, sub.Name)
+		m := make(map[string]string)
+		for s, g := range match.Nodes {
+			if g != follow {
+				m[s] = g
+			}
+		}
+		c.prims = append(c.prims, &primitive.Primitive{Prim: sub.Name, Node: name, Nodes: m})
+		return name, nil
+	}
+	name := merge.UniqName(c.graph, c.used, Unstructured)
+	m := make(map[string]string)
+	for _, n := range rg.Nodes.Nodes {
+		if n.Name != follow {
+			m[n.Name] = n.Name
+		}
+	}
+	c.prims = append(c.prims, &primitive.Primitive{Prim: Unstructured, Node: name, Nodes: m})
+	return name, nil
+}
+
+// findList locates an isomorphism of the "list" subgraph in the region graph
+// which does not contain the node succeeding the region.
+func (c *classifier) findList(rg *dot.Graph, follow string) (*iso.Match, bool) {
+	for _, match := range c.matcher.SearchAll(rg, c.list) {
+		ok := true
+		for _, n := range match.Nodes {
+			if n == follow {
+				ok = false
+			}
+		}
+		if ok {
+			return match, true
+		}
+	}
+	return nil, false
+}
+
+// addEdge adds an edge from src to dst to the region graph, which represents the
+// edge from the node orig to the node succ of graph, unless already present.
+func (c *classifier) addEdge(rg *dot.Graph, orig, succ, src, dst string) {
+	if _, ok := rg.Edges.SrcToDsts[src][dst]; ok {
+		return
+	}
+	attrs := make(map[string]string)
+	if e, ok := c.graph.Edges.SrcToDsts[orig][succ]; ok {
+		for key, val := range e.Attrs {
+			attrs[key] = val
+		}
+	}
+	rg.AddEdge(src, "", dst, "", true, attrs)
+}
+
+// covers reports whether the isomorphism m of sub covers every node of the
+// region graph, except for the node succeeding the region, which may only be
+// mapped to the exit node of sub.
+func covers(rg *dot.Graph, m map[string]string, sub *graphs.SubGraph, follow string) bool {
+	mapped := make(map[string]bool)
+	for s, g := range m {
+		if g == follow && s != sub.Exit() {
+			return false
+		}
+		mapped[g] = true
+	}
+	for _, n := range rg.Nodes.Nodes {
+		if n.Name != follow && !mapped[n.Name] {
+			return false
+		}
+	}
+	return true
+}
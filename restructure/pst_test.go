@@ -0,0 +1,83 @@
+package restructure
+
+import (
+	"reflect"
+	"testing"
+
+	"decomp.org/x/graphs/iso"
+	"decomp.org/x/graphs/primitive"
+	"github.com/mewfork/dot"
+)
+
+func TestClassify(t *testing.T) {
+	golden := []struct {
+		graphPath string
+		// Number of primitives classified.
+		n int
+		// First primitives classified.
+		want []*primitive.Primitive
+	}{
+		// i=0
+		{
+			graphPath: "../testdata/infinity_graphs/main.dot",
+			n:         2,
+			want: []*primitive.Primitive{
+				{Prim: "list", Node: "list0", Nodes: map[string]string{"A": "1", "B": "2"}},
+				{Prim: Unstructured, Node: "unstructured0", Nodes: map[string]string{"0": "0", "list0": "list0"}},
+			},
+		},
+		// i=1
+		{
+			graphPath: "../testdata/irreducible_graphs/nested.dot",
+			n:         3,
+			want: []*primitive.Primitive{
+				{Prim: Unstructured, Node: "unstructured0", Nodes: map[string]string{"1": "1", "2": "2", "3": "3"}},
+				{Prim: "list", Node: "list0", Nodes: map[string]string{"A": "0", "B": "unstructured0"}},
+				{Prim: "list", Node: "list1", Nodes: map[string]string{"A": "list0", "B": "4"}},
+			},
+		},
+		// i=2
+		{
+			graphPath: "../testdata/c4_graphs/stmt.dot",
+			n:         11,
+			want: []*primitive.Primitive{
+				{Prim: "if", Node: "if0", Nodes: map[string]string{"A": "17", "B": "24", "C": "32"}},
+				// The exit node "93" of the pre-test loop succeeds the region.
+				{Prim: "pre_loop", Node: "pre_loop0", Nodes: map[string]string{"A": "89", "B": "92"}},
+			},
+		},
+	}
+
+	subs, err := parsePrims()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, g := range golden {
+		graph, err := dot.ParseFile(g.graphPath)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		n := len(graph.Nodes.Nodes)
+		prims, err := Classify(graph, subs, iso.Matcher{})
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		if len(graph.Nodes.Nodes) != n {
+			t.Errorf("i=%d: node count mismatch; expected %d, got %d", i, n, len(graph.Nodes.Nodes))
+		}
+		if len(prims) != g.n {
+			t.Errorf("i=%d: primitive count mismatch; expected %d, got %d", i, g.n, len(prims))
+			continue
+		}
+		got := prims[:len(g.want)]
+		if !reflect.DeepEqual(got, g.want) {
+			t.Errorf("i=%d: primitives mismatch; expected %v, got %v", i, g.want, got)
+		}
+		// The classified primitives form a single control flow structure tree.
+		if roots := primitive.NewTree(prims); len(roots) != 1 {
+			t.Errorf("i=%d: root count mismatch; expected 1, got %d", i, len(roots))
+		}
+	}
+}
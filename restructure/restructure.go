@@ -0,0 +1,88 @@
+// Package restructure implements control flow restructuring of graphs, by
+// repeatedly merging isomorphisms of control flow primitives into single nodes.
+package restructure
+
+import (
+	"decomp.org/x/graphs"
+	"decomp.org/x/graphs/dom"
+	"decomp.org/x/graphs/iso"
+	"decomp.org/x/graphs/merge"
+	"decomp.org/x/graphs/primitive"
+	"github.com/mewfork/dot"
+	"github.com/mewkiz/pkg/errutil"
+)
+
+// Prims specifies the names of the control flow primitives used to restructure
+// graphs, in order of priority.
+var Prims = []string{
+	"list",
+	"if",
+	"if_else",
+	"if_return",
+	"pre_loop",
+	"post_loop",
+	"inf_loop",
+}
+
+// Restructure repeatedly locates an isomorphism of the highest priority
+// subgraph of subs in graph, and merges it into a single node, until graph is
+// reduced to a single node or no isomorphism of any subgraph could be located.
+// Subgraphs are given in order of priority. Graph is restructured in place;
+// the caller may inspect the remaining nodes of graph to determine whether it
+// was reduced to a single node.
+//
+// The primitives merged are returned in the order they were merged. Nodes of a
+// primitive may refer to the nodes of primitives merged before it, thus forming
+// a hierarchy of primitives. The node names of merged primitives are unique
+// throughout the restructuring.
+func Restructure(graph *dot.Graph, subs []*graphs.SubGraph, matcher iso.Matcher) ([]*primitive.Primitive, error) {
+	// Cache the dominator tree of graph between merges.
+	if matcher.Dom == nil {
+		matcher.Dom = &dom.Cache{}
+	}
+	r := &restructurer{graph: graph, subs: subs, matcher: matcher, used: make(map[string]bool)}
+	var prims []*primitive.Primitive
+	for {
+		prim, ok, err := r.reduce()
+		if err != nil {
+			return nil, errutil.Err(err)
+		}
+		if !ok {
+			return prims, nil
+		}
+		prims = append(prims, prim)
+	}
+}
+
+// restructurer tracks the state of a restructuring.
+type restructurer struct {
+	graph   *dot.Graph
+	subs    []*graphs.SubGraph
+	matcher iso.Matcher
+	// node names of the primitives merged so far.
+	used map[string]bool
+}
+
+// reduce merges an isomorphism of the highest priority subgraph in graph into a
+// single node. The boolean value is true if such an isomorphism could be
+// located, and false otherwise.
+func (r *restructurer) reduce() (prim *primitive.Primitive, ok bool, err error) {
+	for _, sub := range r.subs {
+		match, ok := r.matcher.Search(r.graph, sub)
+		if !ok {
+			continue
+		}
+		name := merge.UniqName(r.graph, r.used, sub.Name)
+		err := merge.MergeAs(r.graph, match.Nodes, sub, name, r.matcher.Dom)
+		if err != nil {
+			return nil, false, errutil.Err(err)
+		}
+		prim = &primitive.Primitive{
+			Prim:  sub.Name,
+			Node:  name,
+			Nodes: match.Nodes,
+		}
+		return prim, true, nil
+	}
+	return nil, false, nil
+}
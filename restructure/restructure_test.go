@@ -0,0 +1,84 @@
+package restructure
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"decomp.org/x/graphs"
+	"decomp.org/x/graphs/iso"
+	"decomp.org/x/graphs/primitive"
+	"github.com/mewfork/dot"
+)
+
+func TestRestructure(t *testing.T) {
+	golden := []struct {
+		graphPath string
+		// Number of primitives merged.
+		n int
+		// Last primitives merged.
+		want []*primitive.Primitive
+	}{
+		// i=0
+		{
+			graphPath: "../testdata/infinity_graphs/main.dot",
+			n:         3,
+			want: []*primitive.Primitive{
+				{Prim: "list", Node: "list0", Nodes: map[string]string{"A": "1", "B": "2"}},
+				{Prim: "inf_loop", Node: "inf_loop0", Nodes: map[string]string{"A": "list0"}},
+				{Prim: "list", Node: "list1", Nodes: map[string]string{"A": "0", "B": "inf_loop0"}},
+			},
+		},
+		// i=1
+		{
+			graphPath: "../testdata/c4_graphs/stmt.dot",
+			n:         21,
+			want: []*primitive.Primitive{
+				{Prim: "if_else", Node: "if_else3", Nodes: map[string]string{"A": "36", "B": "if_else2", "C": "if_return5", "D": "109"}},
+				{Prim: "if_else", Node: "if_else4", Nodes: map[string]string{"A": "0", "B": "if_else3", "C": "if_return4", "D": "110"}},
+			},
+		},
+	}
+
+	subs, err := parsePrims()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, g := range golden {
+		graph, err := dot.ParseFile(g.graphPath)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		prims, err := Restructure(graph, subs, iso.Matcher{})
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		if len(graph.Nodes.Nodes) != 1 {
+			t.Errorf("i=%d: node count mismatch; expected 1, got %d", i, len(graph.Nodes.Nodes))
+		}
+		if len(prims) != g.n {
+			t.Errorf("i=%d: primitive count mismatch; expected %d, got %d", i, g.n, len(prims))
+			continue
+		}
+		got := prims[len(prims)-len(g.want):]
+		if !reflect.DeepEqual(got, g.want) {
+			t.Errorf("i=%d: primitives mismatch; expected %v, got %v", i, g.want, got)
+		}
+	}
+}
+
+// parsePrims parses the subgraphs of the control flow primitives, in order of
+// priority.
+func parsePrims() ([]*graphs.SubGraph, error) {
+	var subs []*graphs.SubGraph
+	for _, name := range Prims {
+		sub, err := graphs.ParseSubGraph(filepath.Join("../testdata/primitives", name+".dot"))
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
@@ -0,0 +1,57 @@
+package graphs
+
+import (
+	"github.com/mewfork/dot"
+	"github.com/mewkiz/pkg/errutil"
+)
+
+// Role specifies the role of a sub node, as given by the "role" node attribute.
+//
+// For backward compatibility, nodes without a "role" attribute fall back to the
+// "label" attribute, if set to "entry", "exit" or "return"; other labels are
+// treated as display text. The "role" attribute takes precedence, which allows
+// labels to be used for display text, e.g.
+//
+//    A [role="entry", label="entry"]
+//    B [role="any", label="exit"]
+type Role string
+
+// Sub node roles.
+const (
+	// RoleAny specifies a sub node without a special role.
+	RoleAny Role = "any"
+	// RoleEntry specifies the entry node of a subgraph, the incoming edges of
+	// which are ignored.
+	RoleEntry Role = "entry"
+	// RoleExit specifies the exit node of a subgraph, the outgoing edges of
+	// which are ignored.
+	RoleExit Role = "exit"
+	// RoleReturn specifies a node without successors, which leaves the
+	// subgraph (e.g. a return statement).
+	RoleReturn Role = "return"
+)
+
+// Role returns the role of the given sub node.
+func (sub *SubGraph) Role(name string) Role {
+	if role, ok := sub.roles[name]; ok {
+		return role
+	}
+	return RoleAny
+}
+
+// parseRole returns the role of the given sub node, as specified by its "role"
+// attribute, or by its "label" attribute if the node has no "role" attribute.
+func parseRole(node *dot.Node) (Role, error) {
+	if role, ok := node.Attrs["role"]; ok {
+		switch r := Role(role); r {
+		case RoleAny, RoleEntry, RoleExit, RoleReturn:
+			return r, nil
+		}
+		return "", errutil.Newf(`invalid "role" attribute %q of node %q; expected "entry", "exit", "return" or "any"`, role, node.Name)
+	}
+	switch r := Role(node.Attrs["label"]); r {
+	case RoleEntry, RoleExit, RoleReturn:
+		return r, nil
+	}
+	return RoleAny, nil
+}
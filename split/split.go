@@ -0,0 +1,199 @@
+// Package split implements node splitting of irreducible graphs.
+package split
+
+import (
+	"sort"
+
+	"decomp.org/x/graphs/analysis"
+	"decomp.org/x/graphs/merge"
+	"github.com/mewfork/dot"
+	"github.com/mewkiz/pkg/errutil"
+)
+
+// Split performs controlled node splitting on the control flow graph until it
+// is reducible. If successful it returns a mapping from cloned node name to
+// original node name, which enables clones to refer back to the nodes of the
+// original graph.
+//
+// For each loop with more than one entry node, one entry node is kept as the
+// loop header. The nodes of the loop reachable from each other entry node
+// without passing through the header are cloned, and the edges from outside the
+// loop to the entry node are redirected to its clone. The header is chosen to
+// minimize the number of cloned nodes; the entry node of the graph is always
+// kept as header.
+//
+// Clones are named after their original node with a unique numeric suffix;
+// e.g. "2_0", "2_1".
+func Split(graph *dot.Graph) (clones map[string]string, err error) {
+	clones = make(map[string]string)
+	for {
+		loops, err := analysis.MultiEntryLoops(graph)
+		if err != nil {
+			return nil, errutil.Err(err)
+		}
+		if len(loops) == 0 {
+			return clones, nil
+		}
+		entry, err := analysis.Entry(graph)
+		if err != nil {
+			return nil, errutil.Err(err)
+		}
+		splitLoop(graph, loops[0], entry.Name, clones)
+	}
+}
+
+// splitLoop splits the nodes of the multi-entry loop, so that it is entered
+// only through its header. The clones are recorded in clones.
+func splitLoop(graph *dot.Graph, loop *analysis.MultiEntryLoop, entry string, clones map[string]string) {
+	nodes := make(map[string]bool)
+	for _, name := range loop.Nodes {
+		nodes[name] = true
+	}
+
+	// Choose the header which minimizes the number of cloned nodes. Entry nodes
+	// are sorted, which makes the algorithm deterministic.
+	header, min := "", -1
+	for _, h := range loop.Entries {
+		if h != entry && nodes[entry] {
+			continue
+		}
+		n := 0
+		for _, e := range loop.Entries {
+			if e != h {
+				n += len(region(graph, nodes, h, e))
+			}
+		}
+		if min == -1 || n < min {
+			header, min = h, n
+		}
+	}
+
+	for _, e := range loop.Entries {
+		if e == header {
+			continue
+		}
+		cloneRegion(graph, nodes, region(graph, nodes, header, e), e, clones)
+	}
+}
+
+// region returns the sorted names of the nodes of the loop which are reachable
+// from the entry node e without passing through the header.
+func region(graph *dot.Graph, nodes map[string]bool, header, e string) []string {
+	visited := map[string]bool{e: true}
+	queue := []string{e}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, succ := range graph.Nodes.Lookup[name].Succs {
+			if !nodes[succ.Name] || succ.Name == header || visited[succ.Name] {
+				continue
+			}
+			visited[succ.Name] = true
+			queue = append(queue, succ.Name)
+		}
+	}
+	var names []string
+	for name := range visited {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cloneRegion clones the given region of the loop, and redirects the edges
+// from outside the loop to the entry node e of the region to its clone. The
+// clones are recorded in clones.
+func cloneRegion(graph *dot.Graph, nodes map[string]bool, region []string, e string, clones map[string]string) {
+	// Create clones.
+	names := make(map[string]string)
+	for _, name := range region {
+		orig := name
+		if o, ok := clones[name]; ok {
+			orig = o
+		}
+		clone := merge.UniqName(graph, nil, orig+"_")
+		graph.AddNode(graph.Name, clone, copyAttrs(graph.Nodes.Lookup[name].Attrs))
+		names[name] = clone
+		clones[clone] = orig
+	}
+
+	// Add the outgoing edges of clones; edges within the region are between
+	// clones.
+	for _, name := range region {
+		for _, succ := range succNames(graph, name) {
+			dst := succ
+			if clone, ok := names[succ]; ok {
+				dst = clone
+			}
+			e := graph.Edges.SrcToDsts[name][succ]
+			graph.AddEdge(names[name], "", dst, "", true, copyAttrs(e.Attrs))
+		}
+	}
+
+	// Redirect the edges from outside the loop to the clone of the entry node.
+	for _, pred := range predNames(graph, e) {
+		if nodes[pred] {
+			continue
+		}
+		edge := graph.Edges.SrcToDsts[pred][e]
+		attrs := copyAttrs(edge.Attrs)
+		delEdge(graph, edge)
+		graph.AddEdge(pred, "", names[e], "", true, attrs)
+	}
+}
+
+// succNames returns the successor node names of the given node, in the order
+// of graph.
+func succNames(graph *dot.Graph, name string) []string {
+	var names []string
+	for _, succ := range graph.Nodes.Lookup[name].Succs {
+		names = append(names, succ.Name)
+	}
+	return names
+}
+
+// predNames returns the predecessor node names of the given node, in the order
+// of graph.
+func predNames(graph *dot.Graph, name string) []string {
+	var names []string
+	for _, pred := range graph.Nodes.Lookup[name].Preds {
+		names = append(names, pred.Name)
+	}
+	return names
+}
+
+// delEdge removes the edge from graph.
+func delEdge(graph *dot.Graph, e *dot.Edge) {
+	var edges []*dot.Edge
+	for _, x := range graph.Edges.Edges {
+		if x != e {
+			edges = append(edges, x)
+		}
+	}
+	graph.Edges.Edges = edges
+	delete(graph.Edges.SrcToDsts[e.Src], e.Dst)
+	delete(graph.Edges.DstToSrcs[e.Dst], e.Src)
+	src, dst := graph.Nodes.Lookup[e.Src], graph.Nodes.Lookup[e.Dst]
+	src.Succs = without(src.Succs, dst)
+	dst.Preds = without(dst.Preds, src)
+}
+
+// without returns the nodes of ns except x.
+func without(ns []*dot.Node, x *dot.Node) []*dot.Node {
+	var out []*dot.Node
+	for _, n := range ns {
+		if n != x {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// copyAttrs returns a copy of the given attributes.
+func copyAttrs(attrs map[string]string) map[string]string {
+	dup := make(map[string]string, len(attrs))
+	for key, val := range attrs {
+		dup[key] = val
+	}
+	return dup
+}
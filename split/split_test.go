@@ -0,0 +1,56 @@
+package split
+
+import (
+	"reflect"
+	"testing"
+
+	"decomp.org/x/graphs/analysis"
+	"github.com/mewfork/dot"
+)
+
+func TestSplit(t *testing.T) {
+	golden := []struct {
+		path   string
+		clones map[string]string
+	}{
+		// i=0
+		{
+			path:   "../testdata/c4_graphs/stmt.dot",
+			clones: map[string]string{},
+		},
+		// i=1
+		{
+			path:   "../testdata/irreducible_graphs/irreducible.dot",
+			clones: map[string]string{"2_0": "2"},
+		},
+		// i=2
+		{
+			path:   "../testdata/irreducible_graphs/nested.dot",
+			clones: map[string]string{"3_0": "3"},
+		},
+	}
+
+	for i, g := range golden {
+		graph, err := dot.ParseFile(g.path)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		clones, err := Split(graph)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(clones, g.clones) {
+			t.Errorf("i=%d: clones mismatch; expected %v, got %v", i, g.clones, clones)
+		}
+		ok, err := analysis.IsReducible(graph)
+		if err != nil {
+			t.Errorf("i=%d: %v", i, err)
+			continue
+		}
+		if !ok {
+			t.Errorf("i=%d: graph irreducible after node splitting", i)
+		}
+	}
+}